@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+const (
+	bootLogKeep    = 5        // rotated console logs kept, besides the current one
+	bootLogMaxSize = 10 << 20 // the capture stops there
+)
+
+// Flags of the `logs` command.
+var (
+	logsFollow bool
+	logsBoot   bool
+	logsDocker bool
+)
+
+// Number of boot log captures running, holding the serial console.
+var bootLogsRunning int32
+
+// Whether to query the VM over its serial console: asked for with --serial,
+// and not taken by a boot log capture, as VirtualBox accepts a single client
+// and each query would wait for its timeout.
+func useSerial() bool {
+	return B2D.Serial && atomic.LoadInt32(&bootLogsRunning) == 0
+}
+
+// File the serial console output of the VM is captured to during `up`.
+func bootLogPath() string {
+	return filepath.Join(B2D.Dir, "logs", B2D.VM, "console.log")
+}
+
+// Where to look when `up` fails, if the console output was captured.
+func bootLogHint() string {
+	if !B2D.BootLog {
+		return ""
+	}
+	return fmt.Sprintf("\nSee the console output of the VM with `boot2docker logs` (%s).", bootLogPath())
+}
+
+// Shift path to path.1, path.1 to path.2 etc., dropping the ones past keep.
+func rotateLogs(path string, keep int) error {
+	os.Remove(fmt.Sprintf("%s.%d", path, keep))
+	for i := keep - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Capture of the serial console output of a booting VM.
+type bootLog struct {
+	path string
+	f    *os.File
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu   sync.Mutex
+	conn io.Closer
+}
+
+// Start capturing the serial console of m into a new bootLogPath(), until
+// stopped. Start it before the VM so that nothing is missed: it keeps
+// trying to connect while the serial socket does not exist yet.
+func startBootLog(m driver.Machine) (*bootLog, error) {
+	path := bootLogPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := rotateLogs(path, bootLogKeep); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return newBootLog(path, f, m.GetSerialFile()), nil
+}
+
+// Capture serialFile into f, opened at path.
+func newBootLog(path string, f *os.File, serialFile string) *bootLog {
+	l := &bootLog{path: path, f: f, done: make(chan struct{})}
+	atomic.AddInt32(&bootLogsRunning, 1)
+	l.wg.Add(1)
+	go l.capture(serialFile)
+	return l
+}
+
+func (l *bootLog) capture(serialFile string) {
+	defer l.wg.Done()
+	var conn io.ReadWriteCloser
+	for {
+		var err error
+		if conn, err = dialSerial(serialFile); err == nil {
+			break
+		}
+		select {
+		case <-l.done:
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	l.mu.Lock()
+	select {
+	case <-l.done:
+		l.mu.Unlock()
+		conn.Close()
+		return
+	default:
+		l.conn = conn
+	}
+	l.mu.Unlock()
+	io.Copy(l.f, io.LimitReader(conn, bootLogMaxSize))
+}
+
+// Stop the capture, freeing the serial console for other clients.
+func (l *bootLog) stop() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	close(l.done)
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	l.f.Close()
+	atomic.AddInt32(&bootLogsRunning, -1)
+}
+
+// Show the captured console log or the Docker daemon log of the VM.
+func cmdLogs(ctx context.Context) error {
+	if logsBoot && logsDocker {
+		return fmt.Errorf("Usage: logs [--follow] [--boot|--docker]")
+	}
+	if logsDocker {
+		m, err := driver.GetMachine(ctx, &B2D)
+		if err != nil {
+			return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
+		}
+		if m.GetState() != driver.Running {
+			return vmNotRunningError(B2D.VM)
+		}
+		cmd := "cat /var/log/docker.log"
+		if logsFollow {
+			cmd = "tail -n +1 -f /var/log/docker.log"
+		}
+		return cmdInteractive(m, cmd)
+	}
+
+	path := bootLogPath()
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("No console log of %q (capture it with `boot2docker --boot-log up`)", B2D.VM)
+		}
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		return err
+	}
+	if !logsFollow {
+		return nil
+	}
+	return followFile(ctx, path, f, os.Stdout)
+}
+
+// Keep copying what is appended to path (opened as f, and read to its end)
+// to w, until ctx is cancelled. A new file at path, e.g. after a rotation, is
+// read from its start.
+func followFile(ctx context.Context, path string, f *os.File, w io.Writer) error {
+	// The file opened after the last rotation, f being the caller's before.
+	var reopened *os.File
+	defer func() {
+		if reopened != nil {
+			reopened.Close()
+		}
+	}()
+	for {
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(500 * time.Millisecond):
+		}
+		cur, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(path); err == nil && !os.SameFile(cur, fi) {
+			// Read the rest of the old file before switching.
+			if _, err := io.Copy(w, f); err != nil {
+				return err
+			}
+			if reopened != nil {
+				reopened.Close()
+			}
+			if reopened, err = os.Open(path); err != nil {
+				return err
+			}
+			f = reopened
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRotateLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2d-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "console.log")
+
+	for i := 0; i < 4; i++ {
+		if err := rotateLogs(path, 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(fmt.Sprint(i)), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{"console.log": "3", "console.log.1": "2", "console.log.2": "1"} {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != want {
+			t.Errorf("%s: got %q (%v), want %q", name, b, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 was kept", path)
+	}
+}
+
+func TestBootLogCapture(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the serial console is a named pipe on Windows")
+	}
+	dir, err := ioutil.TempDir("", "b2d-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	serial := filepath.Join(dir, "vm.sock")
+	f, err := os.Create(filepath.Join(dir, "console.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := B2D
+	defer func() { B2D = saved }()
+	B2D.Serial = true
+	// The socket appears after the capture starts, like when the VM boots.
+	l := newBootLog(f.Name(), f, serial)
+	time.Sleep(100 * time.Millisecond)
+	// The capture holds the serial console, so queries skip it.
+	if useSerial() {
+		t.Errorf("useSerial() during the capture")
+	}
+
+	ln, err := net.Listen("unix", serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("Booting boot2docker\r\n"))
+	time.Sleep(100 * time.Millisecond)
+	l.stop()
+	conn.Close()
+	if !useSerial() {
+		t.Errorf("!useSerial() after the capture")
+	}
+
+	if b, err := ioutil.ReadFile(l.path); err != nil || string(b) != "Booting boot2docker\r\n" {
+		t.Errorf("got %q (%v)", b, err)
+	}
+}
+
+func TestFollowFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2d-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "console.log")
+	if err := ioutil.WriteFile(path, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- followFile(ctx, path, f, &out) }()
+
+	// Lines appended before a rotation are read, then the new file.
+	time.Sleep(100 * time.Millisecond)
+	old, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(old, "b\n")
+	old.Close()
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1200 * time.Millisecond)
+
+	// Cancelling ends the follow without an error.
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("followFile kept running after the context was cancelled")
+	}
+	if got := out.String(); got != "a\nb\nc\n" {
+		t.Errorf("got %q, want %q", got, "a\nb\nc\n")
+	}
+}
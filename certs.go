@@ -0,0 +1,473 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Shell script run as root in the VM, with a tar of the CA directory on its
+// stdin, to install the CA certificates into /var/lib/boot2docker/certs. The
+// ones installed by a previous run but since removed are deleted, as listed
+// in .boot2docker-ca.
+const caInstaller = `
+set -e
+certs=/var/lib/boot2docker/certs
+manifest=$certs/.boot2docker-ca
+bundle=/etc/ssl/certs/ca-certificates.crt
+stage=$(mktemp -d)
+tar xf - -C $stage
+mkdir -p $certs
+touch $manifest
+for name in $(cat $manifest); do
+	if [ ! -f "$stage/$name" ]; then
+		rm -f "$certs/$name"
+		echo "Removed CA certificate $name (still trusted until the VM restarts)"
+	fi
+done
+: > $manifest
+for cert in $stage/*.pem; do
+	[ -f "$cert" ] || continue
+	name=$(basename "$cert")
+	echo "$name" >> $manifest
+	cmp -s "$cert" "$certs/$name" && continue
+	cp "$cert" "$certs/$name"
+	echo "Installed CA certificate $name"
+	if ! grep -qF "$(sed -n 2p "$cert")" $bundle; then
+		cat "$cert" >> $bundle
+		echo "` + certsChangedMarker + `"
+	fi
+done
+rm -rf $stage
+`
+
+var reCAName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Directory of the CA certificates added with `certs add-ca`.
+func caDir() string {
+	return filepath.Join(B2D.Dir, "ca")
+}
+
+// Read the certificates of a PEM or DER file.
+func readCertificates(filename string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for rest := b; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		cert, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: no PEM or DER encoded certificate found", filename)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// Manage the certificates of the VM.
+func cmdCerts(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Usage: certs {status|regenerate|add-ca <file> [<name>]|rm-ca <name>|ls}")
+	}
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "status":
+		return certsStatus(ctx)
+	case "regenerate":
+		return regenerateCerts(ctx)
+	case "add-ca":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("Usage: certs add-ca <file> [<name>]")
+		}
+		name := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+		if len(args) == 2 {
+			name = args[1]
+		}
+		if err := addCA(args[0], name); err != nil {
+			return err
+		}
+		return syncCACertsNow(ctx)
+	case "rm-ca", "rm":
+		if len(args) != 1 {
+			return fmt.Errorf("Usage: certs rm-ca <name>")
+		}
+		if err := rmCA(args[0]); err != nil {
+			return err
+		}
+		return syncCACertsNow(ctx)
+	case "ls", "list":
+		return listCACerts()
+	default:
+		return unknownCommandError{cmd: "certs " + cmd}
+	}
+}
+
+// Remove <caDir>/<name>.pem, added by addCA.
+func rmCA(name string) error {
+	if !reCAName.MatchString(name) {
+		return fmt.Errorf("Invalid CA certificate name %q", name)
+	}
+	if err := os.Remove(filepath.Join(caDir(), name+".pem")); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("No CA certificate named %q", name)
+		}
+		return fmt.Errorf("Failed to remove CA certificate %q: %s", name, err)
+	}
+	return nil
+}
+
+// Store the certificates of filename as <caDir>/<name>.pem.
+func addCA(filename, name string) error {
+	if !reCAName.MatchString(name) {
+		return fmt.Errorf("Invalid CA certificate name %q", name)
+	}
+	certs, err := readCertificates(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to read CA certificate: %s", err)
+	}
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		if !cert.IsCA {
+			fmt.Fprintf(os.Stderr, "Warning: %q is not a CA certificate\n", cert.Subject.CommonName)
+		}
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(caDir(), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(caDir(), name+".pem"), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Failed to store CA certificate %q: %s", name, err)
+	}
+	fmt.Printf("Added CA certificate %q\n", name)
+	return nil
+}
+
+// Install the CA certificates right away if the VM is running; otherwise the
+// next `up` does.
+func syncCACertsNow(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil || m.GetState() != driver.Running {
+		fmt.Println("The CA certificates will be installed by the next `boot2docker up`.")
+		return nil
+	}
+	changed, err := installCACerts(m)
+	if err != nil {
+		return fmt.Errorf("Failed to install the CA certificates: %s", err)
+	}
+	if changed {
+		fmt.Println("Restarting the Docker daemon...")
+		return restartDockerDaemon(ctx, m)
+	}
+	return nil
+}
+
+// Install the CA certificates of caDir into the VM, removing the ones that
+// were removed from caDir. Returns whether the Docker daemon needs a restart.
+func installCACerts(m driver.Machine) (bool, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if _, err := os.Stat(caDir()); err == nil {
+		files, err := filepath.Glob(filepath.Join(caDir(), "*.pem"))
+		if err != nil {
+			return false, err
+		}
+		for _, file := range files {
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				return false, err
+			}
+			hdr := &tar.Header{Name: filepath.Base(file), Mode: 0644, Size: int64(len(b)), ModTime: time.Now()}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return false, err
+			}
+			if _, err := tw.Write(b); err != nil {
+				return false, err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return false, err
+	}
+	return runVMScript(m, "sudo sh -c "+shellQuote(caInstaller), &buf)
+}
+
+func listCACerts() error {
+	type entry struct {
+		Name     string    `json:"Name" yaml:"Name"`
+		Subject  string    `json:"Subject" yaml:"Subject"`
+		NotAfter time.Time `json:"NotAfter" yaml:"NotAfter"`
+	}
+	files, err := filepath.Glob(filepath.Join(caDir(), "*.pem"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	list := []entry{}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".pem")
+		certs, err := readCertificates(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+			continue
+		}
+		for _, cert := range certs {
+			list = append(list, entry{name, cert.Subject.CommonName, cert.NotAfter})
+		}
+	}
+	return printFormatted(list, func(w io.Writer) error {
+		fmt.Fprintln(w, "NAME\tSUBJECT\tEXPIRES")
+		for _, e := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", e.Name, e.Subject, e.NotAfter.Format("2006-01-02"))
+		}
+		return nil
+	})
+}
+
+// How long before expiry `up` and `shellinit` start warning about a
+// certificate.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// Directory of the host copy of the VM's client certificates, as written by
+// RequestCertsUsingSSH.
+func vmCertPath() (string, error) {
+	dir, err := cfgDir(".boot2docker")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "certs", B2D.VM), nil
+}
+
+// A certificate of the Docker TLS setup, as shown by `certs status`.
+type certInfo struct {
+	Role     string    `json:"Role" yaml:"Role"` // ca, client or server
+	Subject  string    `json:"Subject" yaml:"Subject"`
+	Issuer   string    `json:"Issuer" yaml:"Issuer"`
+	SANs     []string  `json:"SANs" yaml:"SANs"`
+	NotAfter time.Time `json:"NotAfter" yaml:"NotAfter"`
+	Warnings []string  `json:"Warnings" yaml:"Warnings"`
+}
+
+func newCertInfo(role string, cert *x509.Certificate) certInfo {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return certInfo{
+		Role:     role,
+		Subject:  cert.Subject.CommonName,
+		Issuer:   cert.Issuer.CommonName,
+		SANs:     sans,
+		NotAfter: cert.NotAfter,
+	}
+}
+
+// Problems with cert: expired or close to it, and for the server certificate
+// a host (the one DOCKER_HOST points at) missing from its SANs.
+func certWarnings(role string, cert *x509.Certificate, host string, now time.Time) []string {
+	warnings := []string{}
+	switch left := cert.NotAfter.Sub(now); {
+	case left <= 0:
+		warnings = append(warnings, fmt.Sprintf("%s certificate expired on %s", role, cert.NotAfter.Format("2006-01-02")))
+	case left < certExpiryWarning:
+		warnings = append(warnings, fmt.Sprintf("%s certificate expires in %d days", role, int((left+24*time.Hour-1)/(24*time.Hour))))
+	}
+	if role == "server" && host != "" && cert.VerifyHostname(host) != nil {
+		warnings = append(warnings, fmt.Sprintf("server certificate is not valid for %s", host))
+	}
+	return warnings
+}
+
+// Get the certificate the Docker daemon at socket presents, without
+// verifying it.
+func serverCertificate(socket, certPath string) (*x509.Certificate, error) {
+	host, port, err := splitDockerSocket(socket)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{}
+	if certPath != "" {
+		if config, err = dockerTLSConfig(certPath); err != nil {
+			return nil, err
+		}
+	}
+	config.InsecureSkipVerify = true
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", net.JoinHostPort(host, port), config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate presented by %s", socket)
+	}
+	return certs[0], nil
+}
+
+// Inspect the host copy of the client certificates and, if socket is not
+// empty, the server certificate.
+func inspectCerts(socket, certPath string) ([]certInfo, error) {
+	host := ""
+	if socket != "" {
+		host, _, _ = splitDockerSocket(socket)
+	}
+	now := time.Now()
+	infos := []certInfo{}
+	for _, c := range []struct{ role, file string }{{"ca", "ca.pem"}, {"client", "cert.pem"}} {
+		certs, err := readCertificates(filepath.Join(certPath, c.file))
+		if err != nil {
+			return nil, err
+		}
+		info := newCertInfo(c.role, certs[0])
+		info.Warnings = certWarnings(c.role, certs[0], "", now)
+		infos = append(infos, info)
+	}
+	if socket != "" {
+		cert, err := serverCertificate(socket, certPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get the server certificate: %s", err)
+		}
+		info := newCertInfo("server", cert)
+		info.Warnings = certWarnings("server", cert, host, now)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Print the certificate warnings for socket and certPath, e.g. in `up`.
+func warnCerts(socket, certPath string) {
+	if socket == "" || certPath == "" {
+		return
+	}
+	infos, err := inspectCerts(socket, certPath)
+	if err != nil {
+		if B2D.Verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to check the TLS certificates: %s\n", err)
+		}
+		return
+	}
+	warned := false
+	for _, info := range infos {
+		for _, w := range info.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+			warned = true
+		}
+	}
+	if warned {
+		fmt.Fprintf(os.Stderr, "Run `boot2docker certs regenerate` to get new certificates.\n")
+	}
+}
+
+// Check that the server certificate of the Docker daemon at socket is valid
+// for its host, e.g. the IPv6 address of --docker-ipv6: the Docker client
+// cannot connect otherwise.
+func checkServerCertHost(socket, certPath string) error {
+	if certPath == "" {
+		return nil
+	}
+	host, _, err := splitDockerSocket(socket)
+	if err != nil {
+		return err
+	}
+	cert, err := serverCertificate(socket, certPath)
+	if err != nil {
+		return fmt.Errorf("Failed to get the server certificate: %s", err)
+	}
+	if err := cert.VerifyHostname(host); err != nil {
+		return fmt.Errorf("the server certificate of the Docker daemon is not valid for %s (it covers %s), so the Docker client cannot connect to it", host, strings.Join(newCertInfo("server", cert).SANs, ", "))
+	}
+	return nil
+}
+
+// Show the client and server certificates of the VM.
+func certsStatus(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil {
+		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
+	}
+	certPath, err := vmCertPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(certPath, "cert.pem")); err != nil {
+		return fmt.Errorf("No client certificates found in %s (is TLS enabled? run `boot2docker up` first)", certPath)
+	}
+	socket := ""
+	if m.GetState() == driver.Running {
+		if socket, err = RequestSocketFromSSH(ctx, m); err != nil {
+			return fmt.Errorf("Error requesting socket: %s", err)
+		}
+	}
+	infos, err := inspectCerts(socket, certPath)
+	if err != nil {
+		return err
+	}
+	return printFormatted(infos, func(w io.Writer) error {
+		fmt.Fprintln(w, "ROLE\tSUBJECT\tISSUER\tSANS\tEXPIRES\t")
+		for _, info := range infos {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Role, info.Subject, info.Issuer,
+				strings.Join(info.SANs, ","), info.NotAfter.Format("2006-01-02"), strings.Join(info.Warnings, "; "))
+		}
+		return nil
+	})
+}
+
+// Have the VM generate new TLS certificates (the Docker daemon creates the
+// missing ones when it starts), and refresh the host copy.
+func regenerateCerts(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil {
+		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
+	}
+	if m.GetState() != driver.Running {
+		return vmNotRunningError(B2D.VM)
+	}
+	if err := getSSHCommand(m, "sudo rm -rf /var/lib/boot2docker/tls /home/docker/.docker/*.pem").Run(); err != nil {
+		return fmt.Errorf("Failed to remove the certificates: %s", err)
+	}
+	fmt.Println("Restarting the Docker daemon to generate new certificates...")
+	if err := restartDockerDaemon(ctx, m); err != nil {
+		return err
+	}
+	certPath, err := RequestCertsUsingSSH(m)
+	if err != nil {
+		return fmt.Errorf("Error copying certificates: %s", err)
+	}
+	socket, err := RequestSocketFromSSH(ctx, m)
+	if err != nil {
+		return fmt.Errorf("Error requesting socket: %s", err)
+	}
+	warnCerts(socket, certPath)
+	return nil
+}
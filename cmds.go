@@ -1,14 +1,17 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,14 +25,33 @@ func vmNotRunningError(vmName string) error {
 }
 
 // Initialize the boot2docker VM from scratch.
-func cmdInit() error {
+func cmdInit(ctx context.Context) error {
 	B2D.Init = false
-	_, err := driver.GetMachine(&B2D)
+	_, err := driver.GetMachine(ctx, &B2D)
 	if err == nil {
 		fmt.Printf("Virtual machine %s already exists\n", B2D.VM)
 		return nil
 	}
 
+	if B2D.Network == "" || B2D.Network == string(driver.NICNetHostonly) {
+		if B2D.AutoHostIP {
+			if err := autoHostOnlySubnet(); err != nil {
+				return fmt.Errorf("Failed to pick a host-only network: %s", err)
+			}
+			fmt.Printf("Using host-only network %s/24 (host IP %s)\n", B2D.HostIP.Mask(B2D.NetMask), B2D.HostIP)
+		} else if err := checkHostOnlySubnet(B2D.HostIP, B2D.NetMask); err != nil {
+			return fmt.Errorf("%s\nPlease choose a free subnet with --hostip, --netmask, --dhcpip, --lowerip and --upperip, or use --hostip=auto.", err)
+		}
+	}
+	if err := checkStaticVMIP(); err != nil {
+		return fmt.Errorf("Invalid --vm-ip: %s", err)
+	}
+	if B2D.Provision != "" {
+		if err := checkProvisionDir(B2D.Provision); err != nil {
+			return fmt.Errorf("Invalid provisioning directory: %s", err)
+		}
+	}
+
 	if _, err := os.Stat(B2D.ISO); err != nil {
 		if !os.IsNotExist(err) {
 			return fmt.Errorf("Failed to open ISO image %q: %s", B2D.ISO, err)
@@ -61,26 +83,47 @@ func cmdInit() error {
 	//TODO: print a ~/.ssh/config entry for our b2d connection that the user can c&p
 
 	B2D.Init = true
-	_, err = driver.GetMachine(&B2D)
+	setProgress("creating the VM")
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
+		if B2D.KeepOnFailure {
+			return fmt.Errorf("Failed to initialize machine %q: %s\nRemove what was kept with `boot2docker delete` before retrying.", B2D.VM, err)
+		}
 		return fmt.Errorf("Failed to initialize machine %q: %s", B2D.VM, err)
 	}
+	if err := m.Refresh(ctx); err == nil {
+		applyProfilePorts(ctx, m)
+	}
+	if err := recordInitProvision(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record the provisioning directory: %s\n", err)
+	}
 	fmt.Printf("Initialization of virtual machine %q complete.\n", B2D.VM)
 	fmt.Printf("Use `boot2docker up` to start it.\n")
 	return nil
 }
 
 // Bring up the VM from all possible states.
-func cmdUp() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdUp(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
-	if err := m.Start(); err != nil {
+	if err := runHook(ctx, hookPreUp, hookEnv{}); err != nil {
+		return err
+	}
+	applyProfilePorts(ctx, m)
+	if B2D.BootLog {
+		bootLog, err := startBootLog(m)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to capture the console output: %s\n", err)
+		}
+		defer bootLog.stop()
+	}
+	if err := runTimed(ctx, B2D.StartTimeout, "starting the VM", m.Start); err != nil {
 		return fmt.Errorf("Failed to start machine %q: %s", B2D.VM, err)
 	}
 
-	if err := m.Refresh(); err != nil {
+	if err := m.Refresh(ctx); err != nil {
 		return fmt.Errorf("Failed to start machine %q: %s", B2D.VM, err)
 	}
 	if m.GetState() != driver.Running {
@@ -90,76 +133,77 @@ func cmdUp() error {
 	fmt.Println("Waiting for VM and Docker daemon to start...")
 	//give the VM a little time to start, so we don't kill the Serial Pipe/Socket
 	time.Sleep(time.Duration(B2D.Waittime) * time.Millisecond)
-	natSSH := fmt.Sprintf("localhost:%d", m.GetSSHPort())
-	IP := ""
-	for i := 1; i < B2D.Retries; i++ {
-		print(".")
-		if B2D.Serial && runtime.GOOS != "windows" {
-			if IP, err = RequestIPFromSerialPort(m.GetSerialFile()); err == nil {
-				break
-			}
-		}
-		if err := read(natSSH, 1, time.Duration(B2D.Waittime)*time.Millisecond); err == nil {
-			if IP, err = RequestIPFromSSH(m); err == nil {
-				break
-			}
-		}
+	ready := newReadiness(ctx, m, time.Duration(B2D.Timeout)*time.Second)
+	ready.progress = true
+	if err := ready.wait(stageSSH, stageIP); err != nil {
+		return fmt.Errorf("\nMachine %q is not ready: %s%s", B2D.VM, err, bootLogHint())
 	}
+	IP := ready.IP
 	if B2D.Verbose {
 		fmt.Printf("VM Host-only IP address: %s", IP)
 		fmt.Printf("\nWaiting for Docker daemon to start...\n")
 	}
-
-	time.Sleep(time.Duration(B2D.Waittime) * time.Millisecond)
-	socket := ""
-	for i := 1; i < B2D.Retries; i++ {
-		print("o")
-		if socket, err = RequestSocketFromSSH(m); err == nil {
-			break
-		}
-		if B2D.Verbose {
-			fmt.Printf("Error requesting socket: %s\n", err)
-		}
-		time.Sleep(600 * time.Millisecond)
+	if staticIP, err := applyStaticIP(ctx, m); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to apply the static VM IP: %s\n", err)
+	} else if staticIP != "" {
+		IP = staticIP
 	}
-	fmt.Printf("\nStarted.\n")
-
-	if socket == "" {
-		// lets try one more time
-		time.Sleep(time.Duration(B2D.Waittime) * time.Millisecond)
-		fmt.Printf("  Trying to get Docker socket one more time\n")
-
-		if socket, err = RequestSocketFromSSH(m); err != nil {
-			fmt.Printf("Error requesting socket: %s\n", err)
+	syncHostsEntry(IP)
+	setProgress("configuring the Docker daemon")
+	restart := false
+	if changed, err := propagateProxy(m); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to pass the proxy settings to the Docker daemon: %s\n", err)
+	} else {
+		restart = restart || changed
+	}
+	if changed, err := applyDaemonConfig(m); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to apply the Docker daemon settings: %s\n", err)
+	} else {
+		restart = restart || changed
+	}
+	if err := uploadInitProvision(m); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+	if changed, err := runProvisioning(m); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	} else {
+		restart = restart || changed
+	}
+	if changed, err := installCACerts(m); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to install the CA certificates: %s\n", err)
+	} else {
+		restart = restart || changed
+	}
+	if restart {
+		fmt.Printf("\nDocker daemon settings changed, restarting the daemon...\n")
+		if err := restartDockerDaemon(ctx, m); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
 		}
 	}
-	// Copying the certs here - someone might have have written a Windows API client.
-	certPath, err := RequestCertsUsingSSH(m)
-	if err != nil {
-		// These errors are not fatal
-		fmt.Fprintf(os.Stderr, "Warning: error copying certificates: %s\n", err)
+
+	// Copying the certs on the way - someone might have have written a Windows API client.
+	if err := ready.waitDocker(); err != nil {
+		return fmt.Errorf("\nDocker daemon of %q is not ready: %s%s", B2D.VM, err, bootLogHint())
 	}
+	socket, certPath := ready.Socket, ready.CertPath
+	fmt.Printf("\nStarted.\n")
+	warnCerts(socket, certPath)
 
-	if socket == "" {
-		fmt.Fprintf(os.Stderr, "Auto detection of the VM's Docker socket failed.\n")
-		fmt.Fprintf(os.Stderr, "Please run `boot2docker -v up` to diagnose.\n")
+	// Check if $DOCKER_* ENV vars are properly configured.
+	if !checkEnvironment(socket, certPath) {
+		fmt.Printf("\nTo connect the Docker client to the Docker daemon, please set:\n")
+		printExport(socket, certPath)
+		fmt.Printf("\nOr run: `eval \"$(boot2docker shellinit)\"`\n")
 	} else {
-		// Check if $DOCKER_* ENV vars are properly configured.
-		if !checkEnvironment(socket, certPath) {
-			fmt.Printf("\nTo connect the Docker client to the Docker daemon, please set:\n")
-			printExport(socket, certPath)
-			fmt.Printf("\nOr run: `eval \"$(boot2docker shellinit)\"`\n")
-		} else {
-			fmt.Printf("Your environment variables are already set correctly.\n")
-		}
+		fmt.Printf("Your environment variables are already set correctly.\n")
 	}
 	fmt.Printf("\n")
-	return nil
+	return runHook(ctx, hookPostUp, hookEnv{IP: IP, Socket: socket, CertPath: certPath})
 }
 
 // Give the user the exact command to run to set the env.
-func cmdShellInit() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdShellInit(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
@@ -168,7 +212,7 @@ func cmdShellInit() error {
 		return vmNotRunningError(B2D.VM)
 	}
 
-	socket, err := RequestSocketFromSSH(m)
+	socket, err := RequestSocketFromSSH(ctx, m)
 	if err != nil {
 		return fmt.Errorf("Error requesting socket: %s\n", err)
 	}
@@ -178,6 +222,12 @@ func cmdShellInit() error {
 		// These errors are not fatal
 		fmt.Fprintf(os.Stderr, "Warning: error copying certificates: %s\n", err)
 	}
+	if B2D.DockerIPv6 {
+		if err := checkServerCertHost(socket, certPath); err != nil {
+			return fmt.Errorf("Cannot use --docker-ipv6: %s", err)
+		}
+	}
+	warnCerts(socket, certPath)
 
 	// Check if $DOCKER_* ENV vars are properly configured.
 	if !checkEnvironment(socket, certPath) {
@@ -263,6 +313,11 @@ func exports(socket, certPath string) map[string]string {
 	out := make(map[string]string)
 
 	out["DOCKER_HOST"] = socket
+	host, port, err := splitDockerSocket(socket)
+	if err == nil {
+		// IPv6 addresses must be bracketed, e.g. tcp://[fd00:b2d::103]:2376
+		out["DOCKER_HOST"] = "tcp://" + net.JoinHostPort(host, port)
+	}
 	out["DOCKER_CERT_PATH"] = certPath
 
 	if runtime.GOOS == "windows" && isUnixShellOnWindows() {
@@ -281,30 +336,35 @@ func exports(socket, certPath string) map[string]string {
 	//if a http_proxy is set, we need to make sure the boot2docker ip
 	//is added to the NO_PROXY environment variable
 	if os.Getenv("http_proxy") != "" || os.Getenv("HTTP_PROXY") != "" {
-		//get the ip from socket/DOCKER_HOST
-		re := regexp.MustCompile("tcp://([^:]+):")
-		if matches := re.FindStringSubmatch(socket); len(matches) == 2 {
-			ip := matches[1]
+		if err == nil {
 			name := "no_proxy"
 			val := os.Getenv("no_proxy")
 			if val == "" {
 				name = "NO_PROXY"
 				val = os.Getenv("NO_PROXY")
 			}
-
-			switch {
-			case val == "":
-				out[name] = ip
-			case strings.Contains(val, ip):
-				out[name] = val
-			default:
-				out[name] = fmt.Sprintf("%s,%s", val, ip)
-			}
+			out[name] = addNoProxy(val, host)
 		}
 	}
 	return out
 }
 
+// Add host to the comma-separated NO_PROXY list val unless it is already
+// there. IPv6 literals are added without brackets, as proxy-aware clients
+// compare them against the bare URL host.
+func addNoProxy(val, host string) string {
+	if val == "" {
+		return host
+	}
+	for _, h := range strings.Split(val, ",") {
+		h = strings.TrimSpace(h)
+		if h == host || strings.Trim(h, "[]") == host {
+			return val
+		}
+	}
+	return val + "," + host
+}
+
 // Tell the user the config (and later let them set it?)
 func cmdConfig() error {
 	dir, err := cfgDir(".boot2docker")
@@ -312,60 +372,74 @@ func cmdConfig() error {
 		return fmt.Errorf("Error working out Profile file location: %s\n", err)
 	}
 	filename := cfgFilename(dir)
-	fmt.Printf("# boot2docker profile filename: %s\n", filename)
-	fmt.Println(printConfig())
-	return nil
+	if outputFormat == "" {
+		fmt.Printf("# boot2docker profile filename: %s\n", filename)
+		fmt.Println(printConfig())
+		return nil
+	}
+	cfg, err := configMap()
+	if err != nil {
+		return fmt.Errorf("Error encoding configuration: %s", err)
+	}
+	return printFormatted(cfg, func(w io.Writer) error {
+		_, err := io.WriteString(w, printConfig())
+		return err
+	})
 }
 
 // Suspend and save the current state of VM on disk.
-func cmdSave() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdSave(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s\n", B2D.VM, err)
 	}
-	if err := m.Save(); err != nil {
+	if err := runTimed(ctx, 0, "saving the VM state", m.Save); err != nil {
 		return fmt.Errorf("Failed to save machine %q: %s\n", B2D.VM, err)
 	}
 	return nil
 }
 
 // Gracefully stop the VM by sending ACPI shutdown signal.
-func cmdStop() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdStop(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
-	if err := m.Stop(); err != nil {
+	env := vmHookEnvFor(ctx, m, hookPreDown, hookPostDown)
+	if err := runHook(ctx, hookPreDown, env); err != nil {
+		return err
+	}
+	if err := runTimed(ctx, B2D.StopTimeout, "stopping the VM", m.Stop); err != nil {
 		return fmt.Errorf("Failed to stop machine %q: %s", B2D.VM, err)
 	}
-	return nil
+	return runHook(ctx, hookPostDown, env)
 }
 
 // Forcefully power off the VM (equivalent to unplug power). Might corrupt disk
 // image.
-func cmdPoweroff() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdPoweroff(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
-	if err := m.Poweroff(); err != nil {
+	if err := runTimed(ctx, 0, "powering off the VM", m.Poweroff); err != nil {
 		return fmt.Errorf("Failed to poweroff machine %q: %s", B2D.VM, err)
 	}
 	return nil
 }
 
 // Upgrade the boot2docker ISO - preserving server state
-func cmdUpgrade() error {
+func cmdUpgrade(ctx context.Context) error {
 	if err := upgradeBoot2DockerBinary(); err != nil {
 		return fmt.Errorf("Error upgrading boot2docker binary: %s", err)
 	}
-	m, err := driver.GetMachine(&B2D)
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err == nil {
 		if m.GetState() == driver.Running || m.GetState() == driver.Saved || m.GetState() == driver.Paused {
 			// Windows won't let us move the ISO aside while it's in use
-			if err = cmdStop(); err == nil {
+			if err = cmdStop(ctx); err == nil {
 				if err = cmdDownload(); err == nil {
-					err = cmdUp()
+					err = cmdUp(ctx)
 				}
 			}
 			return err
@@ -462,73 +536,207 @@ func backupBinary(binaryName, localVersion, path string) error {
 }
 
 // Gracefully stop and then start the VM.
-func cmdRestart() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdRestart(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
-	if err := m.Restart(); err != nil {
+	if err := runTimed(ctx, restartTimeout(), "restarting the VM", m.Restart); err != nil {
 		return fmt.Errorf("Failed to restart machine %q: %s", B2D.VM, err)
 	}
 	return nil
 }
 
+// Restart stops then starts the VM, within both their timeouts.
+func restartTimeout() uint {
+	if B2D.StartTimeout == 0 || B2D.StopTimeout == 0 {
+		return 0
+	}
+	return B2D.StartTimeout + B2D.StopTimeout
+}
+
 // Forcefully reset (equivalent to cold boot) the VM. Might corrupt disk image.
-func cmdReset() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdReset(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
-	if err := m.Reset(); err != nil {
+	if err := runTimed(ctx, 0, "resetting the VM", m.Reset); err != nil {
 		return fmt.Errorf("Failed to reset machine %q: %s", B2D.VM, err)
 	}
 	return nil
 }
 
 // Delete the VM and associated disk image.
-func cmdDelete() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdDelete(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		if err == driver.ErrMachineNotExist {
 			return fmt.Errorf("Machine %q does not exist.", B2D.VM)
 		}
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
-	if err := m.Delete(); err != nil {
+	if err := runHook(ctx, hookPreDelete, vmHookEnvFor(ctx, m, hookPreDelete)); err != nil {
+		return err
+	}
+	if err := runTimed(ctx, 0, "deleting the VM", m.Delete); err != nil {
 		return fmt.Errorf("Failed to delete machine %q: %s", B2D.VM, err)
 	}
+	clearHostsEntry()
+	return nil
+}
+
+// Manage the host networks of the driver.
+func cmdNetwork(ctx context.Context, args []string) error {
+	if len(args) != 1 || args[0] != "prune" {
+		return fmt.Errorf("Usage: network prune")
+	}
+	removed, err := driver.PruneNetworks(ctx, &B2D)
+	for _, name := range removed {
+		fmt.Printf("Removed %s\n", name)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to prune networks: %s", err)
+	}
+	if len(removed) == 0 {
+		fmt.Println("No unused networks found.")
+	}
 	return nil
 }
 
 // Show detailed info of the VM.
-func cmdInfo() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdInfo(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
-	b, err := json.MarshalIndent(m, "", "\t")
+	info := m.GetInfo()
+	err = printFormatted(info, func(w io.Writer) error {
+		fmt.Fprintf(w, "Name:\t%s\n", info.Name)
+		if info.UUID != "" {
+			fmt.Fprintf(w, "UUID:\t%s\n", info.UUID)
+		}
+		fmt.Fprintf(w, "Driver:\t%s\n", info.Driver)
+		fmt.Fprintf(w, "State:\t%s\n", info.State)
+		fmt.Fprintf(w, "CPUs:\t%d\n", info.CPUs)
+		fmt.Fprintf(w, "Memory:\t%d MB\n", info.Memory)
+		fmt.Fprintf(w, "SSH port:\t%d\n", info.SSHPort)
+		if info.DockerPort > 0 {
+			fmt.Fprintf(w, "Docker port:\t%d\n", info.DockerPort)
+		}
+		if info.ISO != "" {
+			fmt.Fprintf(w, "ISO:\t%s\n", info.ISO)
+		}
+		for _, disk := range info.Disks {
+			fmt.Fprintf(w, "Disk:\t%s\n", disk)
+		}
+		for _, nic := range info.NICs {
+			fmt.Fprintf(w, "NIC %d:\t%s", nic.Slot, nic.Network)
+			if nic.Adapter != "" {
+				fmt.Fprintf(w, " (%s)", nic.Adapter)
+			}
+			if nic.MacAddr != "" {
+				fmt.Fprintf(w, " %s", nic.MacAddr)
+			}
+			fmt.Fprintln(w)
+		}
+		names := make([]string, 0, len(info.SharedFolders))
+		for name := range info.SharedFolders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "Shared folder:\t%s => %s\n", name, info.SharedFolders[name])
+		}
+		if info.GuestAdditions != "" {
+			fmt.Fprintf(w, "Guest additions:\t%s\n", info.GuestAdditions)
+		}
+		if info.SerialFile != "" {
+			fmt.Fprintf(w, "Serial file:\t%s\n", info.SerialFile)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("Failed to encode machine %q info: %s", B2D.VM, err)
+		return fmt.Errorf("Failed to print machine %q info: %s", B2D.VM, err)
 	}
-
-	os.Stdout.Write(b)
-
 	return nil
 }
 
 // Show the current state of the VM.
-func cmdStatus() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdStatus(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
-	fmt.Println(m.GetState())
-	return nil
+	status := struct {
+		Name  string              `json:"Name" yaml:"Name"`
+		State driver.MachineState `json:"State" yaml:"State"`
+	}{m.GetName(), m.GetState()}
+	return printFormatted(status, func(w io.Writer) error {
+		fmt.Fprintln(w, status.State)
+		return nil
+	})
+}
+
+// Block until the --for condition holds for the VM.
+func cmdWait(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil {
+		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
+	}
+	r := newReadiness(ctx, m, time.Duration(B2D.Timeout)*time.Second)
+	if err := r.wait(stageRunning); err != nil {
+		return err
+	}
+	if B2D.WaitFor == waitForRunning {
+		return nil
+	}
+	if err := r.wait(stageSSH); err != nil {
+		return err
+	}
+	if B2D.WaitFor == waitForSSH {
+		return nil
+	}
+	return r.waitDocker()
+}
+
+// List the VMs known to the driver and their state.
+func cmdList(ctx context.Context) error {
+	names, err := driver.ListMachines(ctx, &B2D)
+	if err != nil {
+		return fmt.Errorf("Failed to list machines: %s", err)
+	}
+	type entry struct {
+		Name  string              `json:"Name" yaml:"Name"`
+		State driver.MachineState `json:"State" yaml:"State"`
+	}
+	list := []entry{}
+	for _, name := range names {
+		mc := B2D
+		mc.VM = name
+		mc.Init = false
+		m, err := driver.GetMachine(ctx, &mc)
+		if err != nil {
+			return fmt.Errorf("Failed to get machine %q: %s", name, err)
+		}
+		list = append(list, entry{Name: name, State: m.GetState()})
+	}
+	return printFormatted(list, func(w io.Writer) error {
+		fmt.Fprintln(w, "NAME\tSTATE")
+		for _, e := range list {
+			active := ""
+			if e.Name == B2D.VM {
+				active = " *"
+			}
+			fmt.Fprintf(w, "%s%s\t%s\n", e.Name, active, e.State)
+		}
+		return nil
+	})
 }
 
 // Call the external SSH command to login into boot2docker VM.
-func cmdSSH() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdSSH(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
@@ -551,8 +759,8 @@ func cmdSSH() error {
 	return nil
 }
 
-func cmdIP() error {
-	m, err := driver.GetMachine(&B2D)
+func cmdIP(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
 	if err != nil {
 		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
 	}
@@ -561,31 +769,24 @@ func cmdIP() error {
 		return vmNotRunningError(B2D.VM)
 	}
 
-	IP := ""
-	if B2D.Serial {
-		if runtime.GOOS != "windows" {
-			if IP, err = RequestIPFromSerialPort(m.GetSerialFile()); err != nil {
-				if B2D.Verbose {
-					fmt.Printf("Error getting IP via Serial: %s\n", err)
-				}
-			}
-		}
+	IP, err := RequestIP(ctx, m)
+	if err != nil && B2D.Verbose {
+		fmt.Printf("Error getting IP: %s\n", err)
 	}
-
 	if IP == "" {
-		if IP, err = RequestIPFromSSH(m); err != nil {
-			if B2D.Verbose {
-				fmt.Printf("Error getting IP via SSH: %s\n", err)
-			}
-		}
-	}
-	if IP != "" {
-		fmt.Println(IP)
-	} else {
 		fmt.Fprintf(os.Stderr, "\nFailed to get VM Host only IP address.\n")
 		fmt.Fprintf(os.Stderr, "\tWas the VM initialized using boot2docker?\n")
+		return nil
 	}
-	return nil
+	syncHostsEntry(IP)
+	addr := struct {
+		Name string `json:"Name" yaml:"Name"`
+		IP   string `json:"IP" yaml:"IP"`
+	}{m.GetName(), IP}
+	return printFormatted(addr, func(w io.Writer) error {
+		fmt.Fprintln(w, addr.IP)
+		return nil
+	})
 }
 
 // Download the boot2docker ISO image.
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddNoProxy(t *testing.T) {
+	for _, tt := range []struct {
+		val, host, want string
+	}{
+		{"", "192.168.59.103", "192.168.59.103"},
+		{"localhost", "192.168.59.103", "localhost,192.168.59.103"},
+		{"localhost,192.168.59.103", "192.168.59.103", "localhost,192.168.59.103"},
+		{"192.168.59.10", "192.168.59.103", "192.168.59.10,192.168.59.103"},
+		{"localhost", "fd00:b2d::103", "localhost,fd00:b2d::103"},
+		{"localhost, [fd00:b2d::103]", "fd00:b2d::103", "localhost, [fd00:b2d::103]"},
+	} {
+		if got := addNoProxy(tt.val, tt.host); got != tt.want {
+			t.Errorf("addNoProxy(%q, %q) = %q, want %q", tt.val, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestCmdWait(t *testing.T) {
+	saved := B2D
+	defer func() { B2D = saved }()
+	B2D.Driver = "dummy"
+	B2D.Timeout = 1
+	B2D.Waittime = 10
+	B2D.WaitFor = waitForRunning
+
+	// The dummy machine is powered off, so it never gets running.
+	start := time.Now()
+	err := cmdWait(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("wait overran its timeout: took %s", d)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
 
 	toml "github.com/BurntSushi/toml"
 	"github.com/boot2docker/boot2docker-cli/driver"
@@ -107,6 +108,9 @@ func config() (*flag.FlagSet, error) {
 	//flags.BoolVarP(&B2D.Init, "init", "i", false, "auto initialize vm instance.")
 
 	flags.BoolVarP(&B2D.Verbose, "verbose", "v", false, "display verbose command invocations.")
+	flags.BoolVar(&B2D.KeepOnFailure, "keep-on-failure", false, "keep what a failed 'init' created, for debugging, instead of rolling it back.")
+	flags.BoolVar(&watchPorts, "watch", false, "keep 'ports' running, following container events until interrupted.")
+	flags.StringVar(&outputFormat, "format", "", "output format for info|status|config|ip|ls: table, json, yaml or a Go template.")
 	flags.StringVar(&B2D.Driver, "driver", "virtualbox", "hypervisor driver.")
 	flags.StringVar(&B2D.SSH, "ssh", "ssh", "path to SSH client utility.")
 	flags.StringVar(&B2D.SSHGen, "ssh-keygen", "ssh-keygen", "path to ssh-keygen utility.")
@@ -118,23 +122,50 @@ func config() (*flag.FlagSet, error) {
 	flags.UintVarP(&B2D.CPUs, "cpus", "c", uint(runtime.NumCPU()), "number of CPUs for boot2docker.")
 	flags.Uint16Var(&B2D.SSHPort, "sshport", 2022, "host SSH port (forward to port 22 in VM).")
 	flags.Uint16Var(&B2D.DockerPort, "dockerport", 0, "host Docker port (forward to port 2376 in VM). (deprecated - use with care)")
-	flags.IPVar(&B2D.HostIP, "hostip", net.ParseIP("192.168.59.3"), "VirtualBox host-only network IP address.")
+	flags.StringVar(&B2D.Network, "network", "hostonly", "VM network type: hostonly or bridged.")
+	flags.StringVar(&B2D.BridgeAdapter, "bridge-adapter", "", "host interface the VM network is bridged to (with --network=bridged).")
+	B2D.HostIP = net.ParseIP("192.168.59.3")
+	flags.Var(hostIPValue{&B2D.HostIP, &B2D.AutoHostIP}, "hostip", "VirtualBox host-only network IP address, or 'auto' to pick a free subnet.")
+	flags.StringVar(&B2D.SubnetPool, "subnet-pool", "192.168.59.0/24,192.168.0.0/16,172.16.0.0/12,10.0.0.0/8", "networks to pick a free /24 host-only network from with --hostip=auto.")
 	flags.IPMaskVar(&B2D.NetMask, "netmask", flag.ParseIPv4Mask("255.255.255.0"), "VirtualBox host-only network mask.")
 	flags.BoolVar(&B2D.DHCPEnabled, "dhcp", true, "enable VirtualBox host-only network DHCP.")
 	flags.IPVar(&B2D.DHCPIP, "dhcpip", net.ParseIP("192.168.59.99"), "VirtualBox host-only network DHCP server address.")
 	flags.IPVar(&B2D.LowerIP, "lowerip", net.ParseIP("192.168.59.103"), "VirtualBox host-only network DHCP lower bound.")
 	flags.IPVar(&B2D.UpperIP, "upperip", net.ParseIP("192.168.59.254"), "VirtualBox host-only network DHCP upper bound.")
+	flags.IPVar(&B2D.VMIP, "vm-ip", nil, "static IP of the VM on the host-only network, outside the DHCP range.")
+	flags.IPVar(&B2D.HostIPv6, "hostipv6", nil, "VirtualBox host-only network IPv6 address (e.g. fd00:b2d::1), unset to disable IPv6.")
+	flags.UintVar(&B2D.IPv6PrefixLen, "ipv6-prefixlen", 64, "VirtualBox host-only network IPv6 prefix length.")
+	flags.BoolVar(&B2D.DockerIPv6, "docker-ipv6", false, "use the VM's global IPv6 address in DOCKER_HOST.")
+	flags.StringVar(&B2D.Provision, "provision", "", "directory of scripts, files/ and certs/ to provision the VM with on first 'up' (see 'provision').")
+	flags.StringVar(&B2D.PreUpHook, "pre-up", "", "host command to run before 'up'.")
+	flags.StringVar(&B2D.PostUpHook, "post-up", "", "host command to run once 'up' is done.")
+	flags.StringVar(&B2D.PreDownHook, "pre-down", "", "host command to run before 'down'.")
+	flags.StringVar(&B2D.PostDownHook, "post-down", "", "host command to run after 'down'.")
+	flags.StringVar(&B2D.PreDeleteHook, "pre-delete", "", "host command to run before 'delete'.")
+	flags.StringVar(&B2D.HookFailure, "hook-failure", "abort", "what to do when a hook fails or times out: abort or warn.")
+	flags.UintVar(&B2D.HookTimeout, "hook-timeout", 60, "hook timeout in seconds (0 for none).")
+	flags.StringVar(&B2D.HTTPProxy, "http-proxy", "", "HTTP proxy for the Docker daemon (default $HTTP_PROXY).")
+	flags.StringVar(&B2D.HTTPSProxy, "https-proxy", "", "HTTPS proxy for the Docker daemon (default $HTTPS_PROXY).")
+	flags.StringVar(&B2D.NoProxy, "no-proxy", "", "hosts the Docker daemon reaches without proxy (default $NO_PROXY).")
+	flags.BoolVar(&B2D.NoProxyPropagation, "no-proxy-propagation", false, "do not pass the proxy settings to the Docker daemon on 'up'.")
+	flags.BoolVar(&B2D.Hosts, "hosts", false, "keep an entry for the VM in the hosts file (updated by 'up' and 'ip', removed by 'delete').")
+	flags.StringVar(&B2D.Hostname, "hostname", "", "host name of the VM in the hosts file (default <vm>.local).")
+	flags.StringVar(&B2D.HostsFile, "hostsfile", defaultHostsFile(), "path to the hosts file.")
 
-	flags.IntVar(&B2D.Waittime, "waittime", 300, "Time in milliseconds to wait between port knocking retries during 'start'")
-	flags.IntVar(&B2D.Retries, "retries", 75, "number of port knocking retries during 'start'")
+	flags.IntVar(&B2D.Waittime, "waittime", 300, "Time in milliseconds to wait between readiness checks during 'start' (doubled after each retry, up to 5s)")
+	flags.UintVar(&B2D.Timeout, "timeout", 300, "time in seconds to wait for the VM and its Docker daemon to be ready (0 for none).")
+	flags.StringVar(&B2D.WaitFor, "for", "docker", "condition 'wait' waits for: running, ssh or docker.")
+	flags.UintVar(&B2D.StartTimeout, "start-timeout", 120, "time in seconds starting the VM may take (0 for none).")
+	flags.UintVar(&B2D.StopTimeout, "stop-timeout", 30, "time in seconds stopping the VM gracefully may take (0 for none).")
 
-	if runtime.GOOS != "windows" {
-		//SerialFile ~~ filepath.Join(dir, B2D.vm+".sock")
-		flags.StringVar(&B2D.SerialFile, "serialfile", "", "path to the serial socket/pipe.")
-		flags.BoolVar(&B2D.Serial, "serial", false, "try serial console to get IP address (experimental)")
-	} else {
-		B2D.Serial = false
-	}
+	//SerialFile ~~ filepath.Join(dir, B2D.vm+".sock"), or \\.\pipe\<vm> on Windows
+	flags.StringVar(&B2D.SerialFile, "serialfile", "", "path to the serial socket/pipe.")
+	flags.BoolVar(&B2D.Serial, "serial", false, "try serial console to get IP address and Docker socket when SSH fails (experimental)")
+	flags.StringVar(&B2D.ConsoleLog, "console-log", "", "file to log the 'console' session to.")
+	flags.BoolVar(&B2D.BootLog, "boot-log", false, "capture the serial console output during 'up' (see 'logs').")
+	flags.BoolVar(&logsFollow, "follow", false, "keep 'logs' running, showing new output until interrupted.")
+	flags.BoolVar(&logsBoot, "boot", false, "show the console output captured during 'up' with 'logs' (default).")
+	flags.BoolVar(&logsDocker, "docker", false, "show the Docker daemon log of the VM with 'logs'.")
 
 	// Set the defaults
 	if err := flags.Parse([]string{}); err != nil {
@@ -143,7 +174,7 @@ func config() (*flag.FlagSet, error) {
 	// Over-ride from the profile file
 	filename := cfgFilename(B2D.Dir)
 	if _, err := os.Lstat(filename); err == nil {
-		if _, err := toml.DecodeFile(filename, &B2D); err != nil {
+		if err := decodeProfile(filename); err != nil {
 			return nil, err
 		}
 	}
@@ -164,7 +195,30 @@ func config() (*flag.FlagSet, error) {
 		sshIdx++
 	}
 	// Command-line overrides profile config.
-	if err := flags.Parse(os.Args[1:sshIdx]); err != nil {
+	args, retriesSet := dropRetriesFlag(os.Args[1:sshIdx])
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if retriesSet || B2D.Retries != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: --retries (Retries in the profile) is deprecated and has no effect, see --timeout\n")
+	}
+
+	// Use the subnet recorded by a previous --hostip=auto `init`, unless
+	// another host IP is given on the command line.
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if B2D.AutoHostIP || !set["hostip"] {
+		if p, err := loadVMProfile(); err == nil && p.HostIP != nil {
+			applyRecordedSubnet(p, set)
+		}
+	}
+
+	if err := checkHookFailure(B2D.HookFailure); err != nil {
+		return nil, err
+	}
+	if err := checkWaitFor(B2D.WaitFor); err != nil {
 		return nil, err
 	}
 
@@ -177,9 +231,50 @@ func config() (*flag.FlagSet, error) {
 	return flags, nil
 }
 
+// Use the host-only subnet recorded in p, except for the settings given on the
+// command line (set, keyed by flag name).
+func applyRecordedSubnet(p *vmProfile, set map[string]bool) {
+	B2D.AutoHostIP = true
+	B2D.HostIP = p.HostIP
+	if !set["netmask"] {
+		B2D.NetMask = p.NetMask
+	}
+	if !set["dhcpip"] {
+		B2D.DHCPIP = p.DHCPIP
+	}
+	if !set["lowerip"] {
+		B2D.LowerIP = p.LowerIP
+	}
+	if !set["upperip"] {
+		B2D.UpperIP = p.UpperIP
+	}
+}
+
+// Remove the deprecated --retries flag (and its value) from args, so that
+// scripts still passing it keep working. It is not registered, to keep it out
+// of the usage.
+func dropRetriesFlag(args []string) ([]string, bool) {
+	kept := make([]string, 0, len(args))
+	found := false
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			return append(kept, args[i:]...), found
+		case arg == "--retries":
+			found = true
+			i++ // skip the value
+		case strings.HasPrefix(arg, "--retries="):
+			found = true
+		default:
+			kept = append(kept, arg)
+		}
+	}
+	return kept, found
+}
+
 func usageShort() {
 	binName := filepath.Base(os.Args[0])
-	fmt.Fprintf(os.Stderr, "Usage: %s [<options>] {help|init|up|ssh|save|down|poweroff|reset|restart|config|status|info|ip|shellinit|delete|download|upgrade|version} [<args>]\n", binName)
+	fmt.Fprintf(os.Stderr, "Usage: %s [<options>] {help|init|up|ssh|console|logs|save|down|poweroff|reset|restart|config|status|info|ls|ip|wait|port|ports|network|daemon|provision|certs|shellinit|delete|download|upgrade|version} [<args>]\n", binName)
 }
 
 func usageLong(flags *flag.FlagSet) {
@@ -192,6 +287,10 @@ Commands:
    init                Create a new Boot2Docker VM.
    up|start|boot       Start VM from any states.
    ssh [ssh-command]   Login to VM via SSH.
+   console             Attach to the serial console of the VM (~. detaches).
+   logs [--follow] [--boot|--docker]
+                       Show the console output captured by 'up --boot-log', or
+                       the Docker daemon log of the VM.
    save|suspend        Suspend VM and save state to disk.
    down|stop|halt      Gracefully shutdown the VM.
    restart             Gracefully reboot the VM.
@@ -200,7 +299,30 @@ Commands:
    delete|destroy      Delete Boot2Docker VM and its disk image.
    config|cfg          Show selected profile file settings.
    info                Display detailed information of VM.
+   ls|list             List VMs known to the driver and their state.
    ip                  Display the IP address of the VM's Host-only network.
+   wait [--for=running|ssh|docker] [--timeout=<seconds>]
+                       Wait for the VM to be running, reachable over SSH, or
+                       its Docker daemon to be ready (default).
+   port add <name> tcp|udp [<hostip>:]<hostport>:<guestport>
+                       Forward a host port to the VM (running or not).
+   port rm <name>      Remove a port forwarding rule.
+   port ls             List the port forwarding rules.
+   ports [--watch]     Forward ports published by containers to localhost.
+   network prune       Remove host-only networks not used by any VM.
+   daemon config set <key> <value>
+                       Set a Docker daemon setting (applied right away if running).
+   daemon config unset <key>
+                       Remove a Docker daemon setting.
+   daemon config get <key>|ls
+                       Show the Docker daemon settings.
+   provision           Upload the --provision directory to the VM and apply it.
+   certs status        Show the Docker TLS certificates, their SANs and expiry.
+   certs regenerate    Regenerate the Docker TLS certificates in the VM.
+   certs add-ca <file> [<name>]
+                       Trust a CA certificate in the VM (installed on 'up').
+   certs rm-ca <name>  Remove a CA certificate added with add-ca.
+   certs ls            List the CA certificates added with add-ca.
    shellinit           Display the shell commands to set up the Docker client.
    status              Display current state of VM.
    download            Download Boot2Docker ISO image.
@@ -211,3 +333,58 @@ Options:
 `, os.Args[0])
 	flags.PrintDefaults()
 }
+
+// Decode the profile file into B2D. Like --hostip, its HostIP may be "auto".
+func decodeProfile(filename string) error {
+	raw := map[string]interface{}{}
+	if _, err := toml.DecodeFile(filename, &raw); err != nil {
+		return err
+	}
+	auto := false
+	for key, val := range raw {
+		if strings.EqualFold(key, "HostIP") && val == "auto" {
+			delete(raw, key)
+			auto = true
+		}
+	}
+	if !auto {
+		_, err := toml.DecodeFile(filename, &B2D)
+		return err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(raw); err != nil {
+		return err
+	}
+	if _, err := toml.Decode(buf.String(), &B2D); err != nil {
+		return err
+	}
+	B2D.AutoHostIP = true
+	return nil
+}
+
+// Flag value for --hostip: an IP address or "auto".
+type hostIPValue struct {
+	ip   *net.IP
+	auto *bool
+}
+
+func (v hostIPValue) String() string {
+	if *v.auto {
+		return "auto"
+	}
+	return v.ip.String()
+}
+
+func (v hostIPValue) Set(s string) error {
+	if s == "auto" {
+		*v.auto = true
+		return nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return fmt.Errorf("invalid IP address %q", s)
+	}
+	*v.ip = ip
+	*v.auto = false
+	return nil
+}
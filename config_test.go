@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeProfile(t *testing.T) {
+	saved := B2D
+	defer func() { B2D = saved }()
+	dir, err := ioutil.TempDir("", "b2d-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "profile")
+
+	for _, tt := range []struct {
+		profile string
+		auto    bool
+		hostIP  string
+	}{
+		{"HostIP = \"192.168.99.1\"\nMemory = 1024\n", false, "192.168.99.1"},
+		{"hostip = \"auto\"\nMemory = 1024\n", true, "192.168.59.3"},
+		{"HostIP = \"auto\"\nMemory = 1024\n", true, "192.168.59.3"},
+	} {
+		B2D = saved
+		B2D.HostIP = net.ParseIP("192.168.59.3")
+		B2D.AutoHostIP = false
+		if err := ioutil.WriteFile(filename, []byte(tt.profile), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := decodeProfile(filename); err != nil {
+			t.Errorf("%q: %s", tt.profile, err)
+			continue
+		}
+		if B2D.AutoHostIP != tt.auto || B2D.HostIP.String() != tt.hostIP || B2D.Memory != 1024 {
+			t.Errorf("%q: got AutoHostIP %v, HostIP %s, Memory %d", tt.profile, B2D.AutoHostIP, B2D.HostIP, B2D.Memory)
+		}
+	}
+}
+
+func TestDropRetriesFlag(t *testing.T) {
+	for _, tt := range []struct {
+		args, want string
+		found      bool
+	}{
+		{"--vm=test up", "--vm=test up", false},
+		{"--retries=10 up", "up", true},
+		{"--retries 10 --vm=test up", "--vm=test up", true},
+		{"up --retries", "up", true},
+		{"up -- --retries=10", "up -- --retries=10", false},
+	} {
+		got, found := dropRetriesFlag(strings.Fields(tt.args))
+		if strings.Join(got, " ") != tt.want || found != tt.found {
+			t.Errorf("dropRetriesFlag(%q) = %q, %v, want %q, %v", tt.args, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestApplyRecordedSubnet(t *testing.T) {
+	saved := B2D
+	defer func() { B2D = saved }()
+	p := &vmProfile{
+		HostIP:  net.ParseIP("192.168.60.1"),
+		NetMask: net.CIDRMask(24, 32),
+		DHCPIP:  net.ParseIP("192.168.60.99"),
+		LowerIP: net.ParseIP("192.168.60.103"),
+		UpperIP: net.ParseIP("192.168.60.254"),
+	}
+
+	// The flags given on the command line win over the recorded subnet.
+	B2D.NetMask = net.CIDRMask(16, 32)
+	B2D.DHCPIP = net.ParseIP("192.168.60.2")
+	applyRecordedSubnet(p, map[string]bool{"dhcpip": true})
+	if !B2D.AutoHostIP || !B2D.HostIP.Equal(p.HostIP) {
+		t.Errorf("host IP %s (auto %v), want the recorded %s", B2D.HostIP, B2D.AutoHostIP, p.HostIP)
+	}
+	if B2D.NetMask.String() != p.NetMask.String() {
+		t.Errorf("netmask %s, want the recorded %s", B2D.NetMask, p.NetMask)
+	}
+	if !B2D.DHCPIP.Equal(net.ParseIP("192.168.60.2")) {
+		t.Errorf("DHCP IP %s, want the one given on the command line", B2D.DHCPIP)
+	}
+	if !B2D.LowerIP.Equal(p.LowerIP) || !B2D.UpperIP.Equal(p.UpperIP) {
+		t.Errorf("DHCP range %s-%s, want the recorded %s-%s", B2D.LowerIP, B2D.UpperIP, p.LowerIP, p.UpperIP)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Escape character of the console: like with ssh, "~." at the start of a line
+// detaches and "~~" sends a single "~".
+const consoleEscape = '~'
+
+// Filters what the user types to the console for the escape sequences.
+type escapeFilter struct {
+	lineStart bool // the last byte ended a line (or nothing was typed yet)
+	escaped   bool // the escape character was typed at the start of a line
+}
+
+func newEscapeFilter() *escapeFilter {
+	return &escapeFilter{lineStart: true}
+}
+
+// Return what of in is to be sent to the VM, and whether the user asked to
+// detach.
+func (f *escapeFilter) filter(in []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(in))
+	for _, c := range in {
+		if f.escaped {
+			f.escaped = false
+			switch c {
+			case '.':
+				return out, true
+			case consoleEscape:
+				out = append(out, c)
+				f.lineStart = false
+				continue
+			}
+			out = append(out, consoleEscape)
+		} else if f.lineStart && c == consoleEscape {
+			f.escaped = true
+			continue
+		}
+		out = append(out, c)
+		f.lineStart = c == '\r' || c == '\n'
+	}
+	return out, false
+}
+
+// Attach the terminal to the serial console of the VM.
+func cmdConsole(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil {
+		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
+	}
+	if m.GetState() != driver.Running {
+		return vmNotRunningError(B2D.VM)
+	}
+	conn, err := dialSerial(m.GetSerialFile())
+	if err != nil {
+		return fmt.Errorf("Failed to connect to the serial console of %q: %s", B2D.VM, err)
+	}
+	defer conn.Close()
+
+	var output io.Writer = os.Stdout
+	if B2D.ConsoleLog != "" {
+		f, err := os.OpenFile(B2D.ConsoleLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("Failed to open the console log: %s", err)
+		}
+		defer f.Close()
+		output = io.MultiWriter(os.Stdout, f)
+	}
+
+	fmt.Printf("Connected to the serial console of %q (type ~. at the start of a line to detach).\n", B2D.VM)
+	restore, err := setRawTerminal()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	// Wake up the getty.
+	conn.Write([]byte("\r"))
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(output, conn)
+		if err == nil {
+			err = fmt.Errorf("the VM closed the serial console")
+		}
+		done <- err
+	}()
+	go func() {
+		filter := newEscapeFilter()
+		buf := make([]byte, 256)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				out, detach := filter.filter(buf[:n])
+				if _, err := io.Copy(conn, bytes.NewReader(out)); err != nil {
+					done <- err
+					return
+				}
+				if detach {
+					done <- nil
+					return
+				}
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	err = <-done
+	restore()
+	fmt.Printf("\r\nDetached from the serial console of %q.\n", B2D.VM)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestEscapeFilter(t *testing.T) {
+	tests := []struct {
+		in     []string
+		out    string
+		detach bool
+	}{
+		{[]string{"ls\r"}, "ls\r", false},
+		{[]string{"~."}, "", true},
+		{[]string{"ls\r~.more"}, "ls\r", true},
+		{[]string{"a~.b"}, "a~.b", false},
+		{[]string{"~~.\r"}, "~.\r", false},
+		{[]string{"~x"}, "~x", false},
+		// The sequence may be split across reads.
+		{[]string{"echo\r", "~", "."}, "echo\r", true},
+	}
+	for _, test := range tests {
+		f := newEscapeFilter()
+		out, detach := "", false
+		for _, in := range test.in {
+			b, d := f.filter([]byte(in))
+			out += string(b)
+			if detach = d; detach {
+				break
+			}
+		}
+		if out != test.out || detach != test.detach {
+			t.Errorf("%q: got %q, %v, want %q, %v", test.in, out, detach, test.out, test.detach)
+		}
+	}
+}
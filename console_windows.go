@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Console input modes (see SetConsoleMode).
+const (
+	enableProcessedInput = 0x0001
+	enableLineInput      = 0x0002
+	enableEchoInput      = 0x0004
+)
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+func setConsoleMode(h syscall.Handle, mode uint32) error {
+	if r, _, err := procSetConsoleMode.Call(uintptr(h), uintptr(mode)); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// Put the console on stdin in raw mode, returning how to restore it: input is
+// read per keystroke, without echo, and Ctrl-C is passed on like stty raw
+// does.
+func setRawTerminal() (func(), error) {
+	h := syscall.Handle(os.Stdin.Fd())
+	var saved uint32
+	if err := syscall.GetConsoleMode(h, &saved); err != nil {
+		return nil, fmt.Errorf("stdin is not a console: %s", err)
+	}
+	raw := saved &^ (enableProcessedInput | enableLineInput | enableEchoInput)
+	if err := setConsoleMode(h, raw); err != nil {
+		return nil, fmt.Errorf("failed to put the console in raw mode: %s", err)
+	}
+	return func() { setConsoleMode(h, saved) }, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Markers of the daemon configuration block in daemonProfile.
+const (
+	daemonConfigBlockBegin = "# BEGIN boot2docker daemon config"
+	daemonConfigBlockEnd   = "# END boot2docker daemon config"
+)
+
+// Daemon settings with a name of their own. The others are set by their
+// daemonProfile variable name, e.g. DOCKER_TLS.
+var daemonConfigKeys = map[string]string{
+	"storage-driver":    "DOCKER_STORAGE",
+	"extra-args":        "EXTRA_ARGS",
+	"registry-mirror":   "--registry-mirror", // comma-separated list
+	"insecure-registry": "--insecure-registry",
+}
+
+var reProfileVar = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+func checkDaemonConfigKey(key string) error {
+	if _, ok := daemonConfigKeys[key]; ok || reProfileVar.MatchString(key) {
+		return nil
+	}
+	names := []string{}
+	for name := range daemonConfigKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("Unknown daemon setting %q (expected one of %s, or a profile variable name)", key, strings.Join(names, ", "))
+}
+
+// Lines of daemonProfile applying the daemon settings. Daemon flags are added
+// to EXTRA_ARGS, after those set outside of the block.
+func daemonProfileLines(config map[string]string) []string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := []string{}
+	args := []string{}
+	for _, key := range keys {
+		value := config[key]
+		switch name := daemonConfigKeys[key]; {
+		case strings.HasPrefix(name, "--"):
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					args = append(args, name+"="+v)
+				}
+			}
+		case name == "EXTRA_ARGS":
+			args = append(args, value)
+		case name != "":
+			lines = append(lines, fmt.Sprintf("%s=%s", name, shellQuote(value)))
+		default:
+			lines = append(lines, fmt.Sprintf("%s=%s", key, shellQuote(value)))
+		}
+	}
+	if len(args) > 0 {
+		lines = append(lines, fmt.Sprintf(`EXTRA_ARGS="$EXTRA_ARGS "%s`, shellQuote(strings.Join(args, " "))))
+	}
+	return lines
+}
+
+// Write the daemon settings of the per-VM profile into the daemon profile of
+// the VM, and return whether they changed (the daemon then needs a restart).
+func applyDaemonConfig(m driver.Machine) (bool, error) {
+	profile, err := loadVMProfile()
+	if err != nil {
+		return false, err
+	}
+	return setVMFileBlock(m, daemonProfile, "", daemonConfigBlockBegin, daemonConfigBlockEnd, daemonProfileLines(profile.Daemon), 0644)
+}
+
+// Restart the Docker daemon of the VM and wait until it accepts connections.
+func restartDockerDaemon(ctx context.Context, m driver.Machine) error {
+	if err := getSSHCommand(m, "sudo /etc/init.d/docker restart").Run(); err != nil {
+		return fmt.Errorf("failed to restart the Docker daemon: %s", err)
+	}
+	if err := newReadiness(ctx, m, time.Duration(B2D.Timeout)*time.Second).wait(stageSocket, stageTCP); err != nil {
+		return fmt.Errorf("the Docker daemon did not come back after a restart: %s", err)
+	}
+	return nil
+}
+
+// Manage the settings of the Docker daemon in the VM.
+func cmdDaemon(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "config" {
+		return fmt.Errorf("Usage: daemon config {set <key> <value>|unset <key>|get <key>|ls}")
+	}
+	args = args[1:]
+	if len(args) == 0 {
+		return fmt.Errorf("Usage: daemon config {set <key> <value>|unset <key>|get <key>|ls}")
+	}
+	profile, err := loadVMProfile()
+	if err != nil {
+		return fmt.Errorf("Failed to read profile of machine %q: %s", B2D.VM, err)
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "set", "unset":
+		if (cmd == "set" && len(args) != 2) || (cmd == "unset" && len(args) != 1) {
+			return fmt.Errorf("Usage: daemon config set <key> <value> | daemon config unset <key>")
+		}
+		if err := checkDaemonConfigKey(args[0]); err != nil {
+			return err
+		}
+		if cmd == "set" {
+			profile.Daemon[args[0]] = args[1]
+		} else {
+			delete(profile.Daemon, args[0])
+		}
+		if err := profile.save(); err != nil {
+			return fmt.Errorf("Failed to save profile of machine %q: %s", B2D.VM, err)
+		}
+		return reapplyDaemonConfig(ctx)
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("Usage: daemon config get <key>")
+		}
+		value, ok := profile.Daemon[args[0]]
+		if !ok {
+			return fmt.Errorf("Daemon setting %q is not set", args[0])
+		}
+		fmt.Println(value)
+	case "ls", "list":
+		return listDaemonConfig(profile.Daemon)
+	default:
+		return unknownCommandError{cmd: "daemon config " + cmd}
+	}
+	return nil
+}
+
+// Apply the daemon settings right away if the VM is running; otherwise the
+// next `up` does.
+func reapplyDaemonConfig(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil || m.GetState() != driver.Running {
+		fmt.Println("The new settings will be applied by the next `boot2docker up`.")
+		return nil
+	}
+	changed, err := applyDaemonConfig(m)
+	if err != nil {
+		return fmt.Errorf("Failed to update the Docker daemon settings: %s", err)
+	}
+	if !changed {
+		return nil
+	}
+	fmt.Println("Restarting the Docker daemon...")
+	if err := restartDockerDaemon(ctx, m); err != nil {
+		return err
+	}
+	fmt.Println("The Docker daemon is up.")
+	return nil
+}
+
+func listDaemonConfig(config map[string]string) error {
+	type entry struct {
+		Key   string `json:"Key" yaml:"Key"`
+		Value string `json:"Value" yaml:"Value"`
+	}
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]entry, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, entry{key, config[key]})
+	}
+	return printFormatted(list, func(w io.Writer) error {
+		fmt.Fprintln(w, "KEY\tVALUE")
+		for _, e := range list {
+			fmt.Fprintf(w, "%s\t%s\n", e.Key, e.Value)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDaemonProfileLines(t *testing.T) {
+	got := daemonProfileLines(map[string]string{
+		"storage-driver":    "overlay",
+		"registry-mirror":   "https://mirror1, https://mirror2",
+		"insecure-registry": "registry.local:5000",
+		"extra-args":        "--debug --label=env='dev'",
+		"DOCKER_TLS":        "no",
+	})
+	want := []string{
+		`DOCKER_TLS='no'`,
+		`DOCKER_STORAGE='overlay'`,
+		`EXTRA_ARGS="$EXTRA_ARGS "'--debug --label=env='\''dev'\'' --insecure-registry=registry.local:5000 --registry-mirror=https://mirror1 --registry-mirror=https://mirror2'`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if got := daemonProfileLines(nil); len(got) != 0 {
+		t.Errorf("got %q for no settings", got)
+	}
+}
+
+func TestCheckDaemonConfigKey(t *testing.T) {
+	for key, ok := range map[string]bool{
+		"storage-driver": true,
+		"DOCKER_TLS":     true,
+		"EXTRA_ARGS":     true,
+		"docker_tls":     false,
+		"storage":        false,
+		"FOO; rm -rf /":  false,
+	} {
+		if err := checkDaemonConfigKey(key); (err == nil) != ok {
+			t.Errorf("%q: got %v, want ok = %v", key, err, ok)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Minimal client for the remote API of the Docker daemon in the VM.
+type dockerClient struct {
+	base   string // e.g. "https://192.168.59.103:2376"
+	client *http.Client
+}
+
+// Create a client for the daemon listening on socket (as returned by
+// RequestSocketFromSSH). If certPath is not empty, the connection uses TLS
+// with the ca.pem, cert.pem and key.pem found there.
+func newDockerClient(socket, certPath string) (*dockerClient, error) {
+	u, err := url.Parse(socket)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "tcp" {
+		return nil, fmt.Errorf("unsupported Docker socket %q", socket)
+	}
+	tr := &http.Transport{}
+	scheme := "http"
+	if certPath != "" {
+		tlsConfig, err := dockerTLSConfig(certPath)
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = tlsConfig
+		scheme = "https"
+	}
+	return &dockerClient{
+		base:   scheme + "://" + u.Host,
+		client: &http.Client{Transport: tr},
+	}, nil
+}
+
+// TLS client configuration using the certificates in certPath.
+func dockerTLSConfig(certPath string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", filepath.Join(certPath, "ca.pem"))
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}, nil
+}
+
+// Open the API endpoint path for reading. The caller must close the body.
+func (c *dockerClient) open(path string) (io.ReadCloser, error) {
+	rsp, err := c.client.Get(c.base + path)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return nil, fmt.Errorf("GET %s: %s: %s", path, rsp.Status, strings.TrimSpace(string(b)))
+	}
+	return rsp.Body, nil
+}
+
+// Decode the JSON document returned by the API endpoint path into v.
+func (c *dockerClient) get(path string, v interface{}) error {
+	body, err := c.open(path)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(v)
+}
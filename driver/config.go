@@ -10,9 +10,10 @@ import (
 // Machine config.
 type MachineConfig struct {
 	// Gereral flags.
-	Init    bool
-	Verbose bool
-	Driver  string
+	Init          bool
+	Verbose       bool
+	Driver        string
+	KeepOnFailure bool // keep what a failed init created, for debugging
 
 	// basic config
 	Clobber              bool
@@ -32,21 +33,63 @@ type MachineConfig struct {
 	SSHPort    uint16 // host SSH port (forward to port 22 in VM)
 	DockerPort uint16 // host Docker port (forward to port 2376 in VM)
 
+	// VM network: hostonly or bridged
+	Network       string
+	BridgeAdapter string // host interface for the bridged network
+
 	// host-only network
+	AutoHostIP  bool   // pick a free subnet from SubnetPool instead of HostIP & co.
+	SubnetPool  string // comma-separated IPv4 networks to pick /24s from
 	HostIP      net.IP
 	DHCPIP      net.IP
 	NetMask     net.IPMask
 	LowerIP     net.IP
 	UpperIP     net.IP
 	DHCPEnabled bool
+	VMIP        net.IP // static IP of the VM, outside LowerIP-UpperIP
+
+	// IPv6 on the host-only network (disabled when HostIPv6 is nil)
+	HostIPv6      net.IP
+	IPv6PrefixLen uint
+	DockerIPv6    bool // use the VM's IPv6 address in DOCKER_HOST
+
+	// proxy settings for the Docker daemon (from the environment by default)
+	HTTPProxy          string
+	HTTPSProxy         string
+	NoProxy            string
+	NoProxyPropagation bool // leave the daemon's proxy settings alone
+
+	// hosts file entry for the VM
+	Hosts     bool   // keep an entry for the VM in HostsFile
+	Hostname  string // name of the entry, <VM>.local by default
+	HostsFile string
+
+	// host commands run around `up`, `down` and `delete`
+	PreUpHook     string
+	PostUpHook    string
+	PreDownHook   string
+	PostDownHook  string
+	PreDeleteHook string
+	HookFailure   string // abort or warn
+	HookTimeout   uint   // in seconds, 0 for none
+
+	// directory of scripts and files to provision the VM with
+	Provision string
 
 	// Serial console pipe/socket
 	Serial     bool
 	SerialFile string
+	ConsoleLog string // file the 'console' session is logged to
+	BootLog    bool   // capture the serial console output during 'up'
 
 	// boot2docker init retry settings
 	Waittime int
-	Retries  int
+	Retries  int    // deprecated, no effect (see Timeout)
+	Timeout  uint   // in seconds, how long 'up' and 'wait' wait for the VM to be ready, 0 for no limit
+	WaitFor  string // condition of 'wait': running, ssh or docker
+
+	StartTimeout uint // in seconds, how long starting the VM may take, 0 for none
+	StopTimeout  uint // in seconds, how long stopping the VM may take, 0 for none
 
 	DriverCfg map[string]interface{}
 }
@@ -1,11 +1,16 @@
 package driver
 
 import (
+	"context"
 	"errors"
 	"fmt"
 )
 
-type InitFunc func(i *MachineConfig) (Machine, error)
+type InitFunc func(ctx context.Context, i *MachineConfig) (Machine, error)
+
+type ListFunc func(ctx context.Context, i *MachineConfig) ([]string, error)
+
+type PruneNetworksFunc func(ctx context.Context, i *MachineConfig) ([]string, error)
 
 type MachineState string
 
@@ -22,34 +27,44 @@ const (
 	Aborted  = MachineState("aborted")
 )
 
-// Machine represents a virtual machine instance
+// Machine represents a virtual machine instance. The operations that talk to
+// the hypervisor give up, and return ctx.Err(), when ctx is done.
 type Machine interface {
-	Start() error
-	Save() error
-	Pause() error
-	Stop() error
-	Refresh() error
-	Poweroff() error
-	Restart() error
-	Reset() error
-	Delete() error
-	Modify() error
-	AddNATPF(n int, name string, rule PFRule) error
-	DelNATPF(n int, name string) error
-	SetNIC(n int, nic NIC) error
-	AddStorageCtl(name string, ctl StorageController) error
-	DelStorageCtl(name string) error
-	AttachStorage(ctlName string, medium StorageMedium) error
+	Start(ctx context.Context) error
+	Save(ctx context.Context) error
+	Pause(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Refresh(ctx context.Context) error
+	Poweroff(ctx context.Context) error
+	Restart(ctx context.Context) error
+	Reset(ctx context.Context) error
+	Delete(ctx context.Context) error
+	Modify(ctx context.Context) error
+	AddNATPF(ctx context.Context, n int, name string, rule PFRule) error
+	DelNATPF(ctx context.Context, n int, name string) error
+	GetNATPFRules(n int) map[string]PFRule
+	SetNIC(ctx context.Context, n int, nic NIC) error
+	AddStorageCtl(ctx context.Context, name string, ctl StorageController) error
+	DelStorageCtl(ctx context.Context, name string) error
+	AttachStorage(ctx context.Context, ctlName string, medium StorageMedium) error
 	GetState() MachineState
 	GetName() string
+	GetInfo() MachineInfo
 	GetSerialFile() string
 	GetDockerPort() uint
 	GetSSHPort() uint
+	// IP address of the VM network interface, if the hypervisor can tell
+	// without logging in the VM (ErrNotSupported otherwise).
+	GetIP(ctx context.Context) (string, error)
 }
 
 var (
 	// All registred machines
 	machines map[string]InitFunc
+	// optional map of driver ListFunc
+	listers map[string]ListFunc
+	// optional map of driver PruneNetworksFunc
+	pruners map[string]PruneNetworksFunc
 
 	ErrNotSupported    = errors.New("driver not supported")
 	ErrMachineNotExist = errors.New("machine does not exist (Did you run `boot2docker init`?)")
@@ -59,6 +74,8 @@ var (
 
 func init() {
 	machines = make(map[string]InitFunc)
+	listers = make(map[string]ListFunc)
+	pruners = make(map[string]PruneNetworksFunc)
 }
 
 func Register(driver string, initFunc InitFunc) error {
@@ -70,9 +87,45 @@ func Register(driver string, initFunc InitFunc) error {
 	return nil
 }
 
-func GetMachine(mc *MachineConfig) (Machine, error) {
+func GetMachine(ctx context.Context, mc *MachineConfig) (Machine, error) {
 	if initFunc, exists := machines[mc.Driver]; exists {
-		return initFunc(mc)
+		return initFunc(ctx, mc)
+	}
+	return nil, ErrNotSupported
+}
+
+// optional - allows a driver to enumerate the machines it knows about
+func RegisterList(driver string, listFunc ListFunc) error {
+	if _, exists := listers[driver]; exists {
+		return fmt.Errorf("Driver already registered %s", driver)
+	}
+	listers[driver] = listFunc
+
+	return nil
+}
+
+func ListMachines(ctx context.Context, mc *MachineConfig) ([]string, error) {
+	if listFunc, exists := listers[mc.Driver]; exists {
+		return listFunc(ctx, mc)
+	}
+	return nil, ErrNotSupported
+}
+
+// optional - allows a driver to remove the host networks no machine uses
+func RegisterPruneNetworks(driver string, pruneFunc PruneNetworksFunc) error {
+	if _, exists := pruners[driver]; exists {
+		return fmt.Errorf("Driver already registered %s", driver)
+	}
+	pruners[driver] = pruneFunc
+
+	return nil
+}
+
+// PruneNetworks removes the host networks not used by any machine and
+// returns their names.
+func PruneNetworks(ctx context.Context, mc *MachineConfig) ([]string, error) {
+	if pruneFunc, exists := pruners[mc.Driver]; exists {
+		return pruneFunc(ctx, mc)
 	}
 	return nil, ErrNotSupported
 }
@@ -0,0 +1,31 @@
+package driver
+
+// MachineInfo is the driver-independent description of a machine reported by
+// `boot2docker info`. Its JSON/YAML encoding is part of the command line
+// interface and must stay backwards compatible: only add fields, never rename
+// or remove them.
+type MachineInfo struct {
+	Name           string            `json:"Name" yaml:"Name"`
+	UUID           string            `json:"UUID,omitempty" yaml:"UUID,omitempty"`
+	Driver         string            `json:"Driver" yaml:"Driver"`
+	State          MachineState      `json:"State" yaml:"State"`
+	CPUs           uint              `json:"CPUs" yaml:"CPUs"`
+	Memory         uint              `json:"Memory" yaml:"Memory"` // MB
+	SSHPort        uint              `json:"SSHPort" yaml:"SSHPort"`
+	DockerPort     uint              `json:"DockerPort,omitempty" yaml:"DockerPort,omitempty"`
+	SerialFile     string            `json:"SerialFile,omitempty" yaml:"SerialFile,omitempty"`
+	ISO            string            `json:"ISO,omitempty" yaml:"ISO,omitempty"`
+	Disks          []string          `json:"Disks" yaml:"Disks"`
+	NICs           []NICInfo         `json:"NICs" yaml:"NICs"`
+	SharedFolders  map[string]string `json:"SharedFolders" yaml:"SharedFolders"` // share name => host path
+	GuestAdditions string            `json:"GuestAdditions,omitempty" yaml:"GuestAdditions,omitempty"`
+}
+
+// NICInfo is the driver-independent description of a network adapter.
+type NICInfo struct {
+	Slot     int         `json:"Slot" yaml:"Slot"`
+	Network  NICNetwork  `json:"Network" yaml:"Network"`
+	Hardware NICHardware `json:"Hardware,omitempty" yaml:"Hardware,omitempty"`
+	Adapter  string      `json:"Adapter,omitempty" yaml:"Adapter,omitempty"`
+	MacAddr  string      `json:"MacAddr,omitempty" yaml:"MacAddr,omitempty"`
+}
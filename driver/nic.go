@@ -5,6 +5,7 @@ type NIC struct {
 	Network         NICNetwork
 	Hardware        NICHardware
 	HostonlyAdapter string
+	BridgeAdapter   string
 }
 
 // NICNetwork represents the type of NIC networks.
@@ -1,6 +1,7 @@
 package dummy
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -27,16 +28,25 @@ func init() {
 		fmt.Fprintf(os.Stderr, "Failed to initialize driver config. Error : %s", err.Error())
 		os.Exit(1)
 	}
+	if err := driver.RegisterList("dummy", ListFunc); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize driver list. Error : %s", err.Error())
+		os.Exit(1)
+	}
 }
 
 // Initialize the Machine.
-func InitFunc(i *driver.MachineConfig) (driver.Machine, error) {
+func InitFunc(ctx context.Context, i *driver.MachineConfig) (driver.Machine, error) {
 	verbose = i.Verbose
 
 	fmt.Printf("Init dummy %s\n", i.VM)
 	return &Machine{Name: i.VM, State: driver.Poweroff}, nil
 }
 
+// List the machines (the dummy driver only knows the configured one).
+func ListFunc(ctx context.Context, i *driver.MachineConfig) ([]string, error) {
+	return []string{i.VM}, nil
+}
+
 // Add cmdline params for this driver
 func ConfigFlags(B2D *driver.MachineConfig, flags *flag.FlagSet) error {
 	//B2D.DriverCfg["dummy"] = cfg
@@ -63,55 +73,55 @@ type Machine struct {
 }
 
 // Refresh reloads the machine information.
-func (m *Machine) Refresh() error {
+func (m *Machine) Refresh(ctx context.Context) error {
 	fmt.Printf("Refresh %s: %s\n", m.Name, m.State)
 	return nil
 }
 
 // Start starts the machine.
-func (m *Machine) Start() error {
+func (m *Machine) Start(ctx context.Context) error {
 	m.State = driver.Running
 	fmt.Printf("Start %s: %s\n", m.Name, m.State)
 	return nil
 }
 
 // Suspend suspends the machine and saves its state to disk.
-func (m *Machine) Save() error {
+func (m *Machine) Save(ctx context.Context) error {
 	m.State = driver.Saved
 	fmt.Printf("Save %s: %s\n", m.Name, m.State)
 	return nil
 }
 
 // Pause pauses the execution of the machine.
-func (m *Machine) Pause() error {
+func (m *Machine) Pause(ctx context.Context) error {
 	m.State = driver.Paused
 	fmt.Printf("Pause %s: %s\n", m.Name, m.State)
 	return nil
 }
 
 // Stop gracefully stops the machine.
-func (m *Machine) Stop() error {
+func (m *Machine) Stop(ctx context.Context) error {
 	m.State = driver.Poweroff
 	fmt.Printf("Stop %s: %s\n", m.Name, m.State)
 	return nil
 }
 
 // Poweroff forcefully stops the machine. State is lost and might corrupt the disk image.
-func (m *Machine) Poweroff() error {
+func (m *Machine) Poweroff(ctx context.Context) error {
 	m.State = driver.Poweroff
 	fmt.Printf("Poweroff %s: %s\n", m.Name, m.State)
 	return nil
 }
 
 // Restart gracefully restarts the machine.
-func (m *Machine) Restart() error {
+func (m *Machine) Restart(ctx context.Context) error {
 	m.State = driver.Running
 	fmt.Printf("Restart %s: %s\n", m.Name, m.State)
 	return nil
 }
 
 // Reset forcefully restarts the machine. State is lost and might corrupt the disk image.
-func (m *Machine) Reset() error {
+func (m *Machine) Reset(ctx context.Context) error {
 	m.State = driver.Running
 	fmt.Printf("Reset %s: %s\n", m.Name, m.State)
 	return nil
@@ -127,6 +137,24 @@ func (m *Machine) GetState() driver.MachineState {
 	return m.State
 }
 
+// Get driver-independent machine information
+func (m *Machine) GetInfo() driver.MachineInfo {
+	return driver.MachineInfo{
+		Name:          m.Name,
+		UUID:          m.UUID,
+		Driver:        "dummy",
+		State:         m.State,
+		CPUs:          m.CPUs,
+		Memory:        m.Memory,
+		SSHPort:       m.SSHPort,
+		DockerPort:    m.DockerPort,
+		SerialFile:    m.SerialFile,
+		Disks:         []string{},
+		NICs:          []driver.NICInfo{},
+		SharedFolders: map[string]string{},
+	}
+}
+
 // Get serial file
 func (m *Machine) GetSerialFile() string {
 	return m.SerialFile
@@ -142,50 +170,60 @@ func (m *Machine) GetSSHPort() uint {
 	return m.SSHPort
 }
 
+// Get IP address
+func (m *Machine) GetIP(ctx context.Context) (string, error) {
+	return "", driver.ErrNotSupported
+}
+
 // Delete deletes the machine and associated disk images.
-func (m *Machine) Delete() error {
+func (m *Machine) Delete(ctx context.Context) error {
 	fmt.Printf("Delete %s: %s\n", m.Name, m.State)
 	return nil
 }
 
 // Modify changes the settings of the machine.
-func (m *Machine) Modify() error {
+func (m *Machine) Modify(ctx context.Context) error {
 	fmt.Printf("Modify %s: %s\n", m.Name, m.State)
-	return m.Refresh()
+	return m.Refresh(ctx)
 }
 
 // AddNATPF adds a NAT port forarding rule to the n-th NIC with the given name.
-func (m *Machine) AddNATPF(n int, name string, rule driver.PFRule) error {
+func (m *Machine) AddNATPF(ctx context.Context, n int, name string, rule driver.PFRule) error {
 	fmt.Println("Add NAT PF")
 	return nil
 }
 
 // DelNATPF deletes the NAT port forwarding rule with the given name from the n-th NIC.
-func (m *Machine) DelNATPF(n int, name string) error {
+func (m *Machine) DelNATPF(ctx context.Context, n int, name string) error {
 	fmt.Println("Del NAT PF")
 	return nil
 }
 
+// GetNATPFRules returns the NAT port forwarding rules of the n-th NIC keyed by name.
+func (m *Machine) GetNATPFRules(n int) map[string]driver.PFRule {
+	return map[string]driver.PFRule{}
+}
+
 // SetNIC set the n-th NIC.
-func (m *Machine) SetNIC(n int, nic driver.NIC) error {
+func (m *Machine) SetNIC(ctx context.Context, n int, nic driver.NIC) error {
 	fmt.Println("Set NIC")
 	return nil
 }
 
 // AddStorageCtl adds a storage controller with the given name.
-func (m *Machine) AddStorageCtl(name string, ctl driver.StorageController) error {
+func (m *Machine) AddStorageCtl(ctx context.Context, name string, ctl driver.StorageController) error {
 	fmt.Println("Add storage ctl")
 	return nil
 }
 
 // DelStorageCtl deletes the storage controller with the given name.
-func (m *Machine) DelStorageCtl(name string) error {
+func (m *Machine) DelStorageCtl(ctx context.Context, name string) error {
 	fmt.Println("Del storage ctl")
 	return nil
 }
 
 // AttachStorage attaches a storage medium to the named storage controller.
-func (m *Machine) AttachStorage(ctlName string, medium driver.StorageMedium) error {
+func (m *Machine) AttachStorage(ctx context.Context, ctlName string, medium driver.StorageMedium) error {
 	fmt.Println("Attach storage")
 	return nil
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"text/template"
+
+	toml "github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats understood by --format. Any other value is parsed as a Go
+// text/template and executed against the command's data, like
+// `docker inspect -f`.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// Value of the --format flag.
+var outputFormat string
+
+// printFormatted writes v to stdout in the format selected by --format. The
+// table func renders the human-readable default.
+func printFormatted(v interface{}, table func(w io.Writer) error) error {
+	return writeFormatted(os.Stdout, outputFormat, v, table)
+}
+
+func writeFormatted(out io.Writer, format string, v interface{}, table func(w io.Writer) error) error {
+	switch format {
+	case "", formatTable:
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		if err := table(w); err != nil {
+			return err
+		}
+		return w.Flush()
+	case formatJSON:
+		b, err := json.MarshalIndent(v, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", b)
+		return err
+	case formatYAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(b)
+		return err
+	}
+
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return fmt.Errorf("invalid --format template: %s", err)
+	}
+	if err := tmpl.Execute(out, v); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out)
+	return err
+}
+
+// configMap returns the current configuration keyed by profile option names,
+// so that json/yaml/template output of `config` matches the profile file.
+func configMap() (map[string]interface{}, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(B2D); err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if _, err := toml.Decode(buf.String(), &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
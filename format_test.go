@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestWriteFormatted(t *testing.T) {
+	v := struct {
+		Name  string `json:"Name" yaml:"Name"`
+		State string `json:"State" yaml:"State"`
+	}{"boot2docker-vm", "running"}
+	table := func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "Name:\t%s\nState:\t%s\n", v.Name, v.State)
+		return err
+	}
+
+	for _, tt := range []struct {
+		format, want string
+	}{
+		{"", "Name:   boot2docker-vm\nState:  running\n"},
+		{"table", "Name:   boot2docker-vm\nState:  running\n"},
+		{"json", "{\n\t\"Name\": \"boot2docker-vm\",\n\t\"State\": \"running\"\n}\n"},
+		{"yaml", "Name: boot2docker-vm\nState: running\n"},
+		{"{{.Name}} is {{.State}}", "boot2docker-vm is running\n"},
+		{"{{json .}}", `{"Name":"boot2docker-vm","State":"running"}` + "\n"},
+	} {
+		var buf bytes.Buffer
+		if err := writeFormatted(&buf, tt.format, v, table); err != nil {
+			t.Errorf("format %q: %s", tt.format, err)
+			continue
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("format %q: got %q, want %q", tt.format, got, tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeFormatted(&buf, "{{.Name", v, table); err == nil {
+		t.Errorf("got no error for an invalid template")
+	}
+}
+
+func TestConfigMap(t *testing.T) {
+	saved := B2D
+	defer func() { B2D = saved }()
+	B2D.VM = "test-vm"
+	B2D.Memory = 1024
+	B2D.Serial = true
+
+	m, err := configMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keyed by the profile option names, with the TOML value types.
+	if m["VM"] != "test-vm" || m["Memory"] != int64(1024) || m["Serial"] != true {
+		t.Errorf("got VM=%#v Memory=%#v Serial=%#v", m["VM"], m["Memory"], m["Serial"])
+	}
+
+	var buf bytes.Buffer
+	if err := writeFormatted(&buf, "{{.VM}} {{.Memory}}", m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "test-vm 1024\n" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Hook names, as in the --pre-up etc. flags.
+const (
+	hookPreUp     = "pre-up"
+	hookPostUp    = "post-up"
+	hookPreDown   = "pre-down"
+	hookPostDown  = "post-down"
+	hookPreDelete = "pre-delete"
+)
+
+// Hook failure policies.
+const (
+	hookAbort = "abort" // fail the command (pre hooks: before acting on the VM)
+	hookWarn  = "warn"  // print a warning and carry on
+)
+
+// What hooks get to know about the VM, besides its name.
+type hookEnv struct {
+	IP       string
+	Socket   string
+	CertPath string
+}
+
+// Command configured for the hook name.
+func hookCommand(name string) string {
+	switch name {
+	case hookPreUp:
+		return B2D.PreUpHook
+	case hookPostUp:
+		return B2D.PostUpHook
+	case hookPreDown:
+		return B2D.PreDownHook
+	case hookPostDown:
+		return B2D.PostDownHook
+	case hookPreDelete:
+		return B2D.PreDeleteHook
+	}
+	return ""
+}
+
+// Environment of a hook command: the boot2docker one, plus the VM details.
+// The DOCKER_* variables are only set when the Docker socket is known.
+func (e hookEnv) environ(name string) []string {
+	env := append(os.Environ(),
+		"BOOT2DOCKER_HOOK="+name,
+		"BOOT2DOCKER_VM="+B2D.VM,
+		"BOOT2DOCKER_IP="+e.IP,
+	)
+	if e.Socket != "" {
+		tlsVerify := ""
+		if e.CertPath != "" {
+			tlsVerify = "1"
+		}
+		env = append(env,
+			"DOCKER_HOST="+e.Socket,
+			"DOCKER_CERT_PATH="+e.CertPath,
+			"DOCKER_TLS_VERIFY="+tlsVerify,
+		)
+	}
+	return env
+}
+
+// Best-effort environment for hooks run while the VM may be up, e.g. before
+// stopping it.
+func vmHookEnv(ctx context.Context, m driver.Machine) hookEnv {
+	env := hookEnv{}
+	if m.GetState() != driver.Running {
+		return env
+	}
+	env.IP, _ = RequestIP(ctx, m)
+	env.Socket, _ = RequestSocketFromSSH(ctx, m)
+	if dir, err := cfgDir(".boot2docker"); err == nil {
+		certPath := filepath.Join(dir, "certs", m.GetName())
+		if _, err := os.Stat(certPath); err == nil {
+			env.CertPath = certPath
+		}
+	}
+	return env
+}
+
+// Environment for the given hooks around an action on m, collected only if
+// one of them is configured.
+func vmHookEnvFor(ctx context.Context, m driver.Machine, names ...string) hookEnv {
+	for _, name := range names {
+		if hookCommand(name) != "" {
+			return vmHookEnv(ctx, m)
+		}
+	}
+	return hookEnv{}
+}
+
+// Run the hook name, if configured, through the shell. A failing or timed
+// out hook is an error with the "abort" failure policy, and a warning with
+// "warn". An interrupted one is always an error.
+func runHook(ctx context.Context, name string, env hookEnv) error {
+	command := hookCommand(name)
+	if command == "" {
+		return nil
+	}
+	if B2D.Verbose {
+		fmt.Printf("Running %s hook: %s\n", name, command)
+	}
+	setProgress("running the %s hook", name)
+	err := execHook(ctx, command, env.environ(name), time.Duration(B2D.HookTimeout)*time.Second)
+	if err == nil {
+		setProgress("")
+		return nil
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	err = fmt.Errorf("%s hook %q failed: %s", name, command, err)
+	if B2D.HookFailure == hookWarn {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+		return nil
+	}
+	return err
+}
+
+// Run command with env, killing it and its children after timeout (if not
+// zero) or once ctx is cancelled: being in their own process group, they don't
+// get the terminal's SIGINT.
+func execHook(ctx context.Context, command string, env []string, timeout time.Duration) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	setHookProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		killHook(cmd)
+		<-done
+		return ctx.Err()
+	case <-expired:
+		killHook(cmd)
+		<-done
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+func checkHookFailure(policy string) error {
+	switch policy {
+	case hookAbort, hookWarn:
+		return nil
+	}
+	return fmt.Errorf("invalid hook failure policy %q (expected abort or warn)", policy)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are tested with sh")
+	}
+	saved := B2D
+	defer func() { B2D = saved }()
+
+	dir, err := ioutil.TempDir("", "b2d-hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	B2D.VM = "test-vm"
+	B2D.HookTimeout = 10
+	B2D.HookFailure = hookAbort
+	B2D.PostUpHook = `echo "$BOOT2DOCKER_HOOK $BOOT2DOCKER_VM $BOOT2DOCKER_IP $DOCKER_HOST $DOCKER_CERT_PATH $DOCKER_TLS_VERIFY" > ` + out
+	env := hookEnv{IP: "192.168.59.103", Socket: "tcp://192.168.59.103:2376", CertPath: "/certs"}
+	if err := runHook(context.Background(), hookPostUp, env); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(b)), "post-up test-vm 192.168.59.103 tcp://192.168.59.103:2376 /certs 1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Unconfigured hooks do nothing.
+	if err := runHook(context.Background(), hookPreDown, env); err != nil {
+		t.Errorf("unconfigured hook: %s", err)
+	}
+
+	B2D.PreDownHook = "exit 3"
+	if err := runHook(context.Background(), hookPreDown, env); err == nil {
+		t.Error("expected an error from a failing hook with the abort policy")
+	}
+	B2D.HookFailure = hookWarn
+	if err := runHook(context.Background(), hookPreDown, env); err != nil {
+		t.Errorf("failing hook with the warn policy: %s", err)
+	}
+}
+
+func TestExecHookTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are tested with sh")
+	}
+	start := time.Now()
+	err := execHook(context.Background(), "exec sleep 5", os.Environ(), 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("hook was not killed on timeout, took %s", d)
+	}
+}
+
+func TestExecHookCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are tested with sh")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	err := execHook(ctx, "exec sleep 5", os.Environ(), 0)
+	if err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("hook was not killed when cancelled, took %s", d)
+	}
+}
+
+func TestExecHookTimeoutKillsChildren(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are tested with sh")
+	}
+	dir, err := ioutil.TempDir("", "b2d-hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "alive")
+
+	// The background child would create marker if it outlived the hook.
+	err = execHook(context.Background(), "(sleep 1; touch "+marker+") & wait", os.Environ(), 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("a child of the hook survived its timeout")
+	}
+}
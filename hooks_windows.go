@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func setHookProcessGroup(cmd *exec.Cmd) {}
+
+// Kill the hook and the processes it started.
+func killHook(cmd *exec.Cmd) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
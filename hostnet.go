@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// A network the host already reaches, through one of its interfaces or a route.
+type hostNet struct {
+	IP     net.IP // interface address, nil for routes
+	Net    net.IPNet
+	Source string // e.g. "interface en0" or "route via utun1"
+}
+
+// Collect the IPv4 networks of the host interfaces and routing table, leaving
+// out the default route, loopback, link-local and multicast ranges.
+func hostNetworks() ([]hostNet, error) {
+	nets := []hostNet{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			n := net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}
+			if ignoredHostNet(n) {
+				continue
+			}
+			nets = append(nets, hostNet{IP: ipnet.IP, Net: n, Source: "interface " + iface.Name})
+		}
+	}
+
+	routes, err := hostRoutes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the routing table: %s", err)
+	}
+	for _, r := range routes {
+		if !ignoredHostNet(r.Net) {
+			nets = append(nets, r)
+		}
+	}
+	return nets, nil
+}
+
+func ignoredHostNet(n net.IPNet) bool {
+	if ones, _ := n.Mask.Size(); ones == 0 {
+		return true // default route
+	}
+	return n.IP.IsLoopback() || n.IP.IsLinkLocalUnicast() || n.IP.IsMulticast()
+}
+
+// Read the IPv4 routing table of the host.
+func hostRoutes() ([]hostNet, error) {
+	switch runtime.GOOS {
+	case "linux":
+		b, err := ioutil.ReadFile("/proc/net/route")
+		if err != nil {
+			return nil, err
+		}
+		return parseLinuxRoutes(string(b))
+	case "darwin", "freebsd":
+		b, err := exec.Command("netstat", "-rn", "-f", "inet").Output()
+		if err != nil {
+			return nil, err
+		}
+		return parseBSDRoutes(string(b))
+	case "windows":
+		b, err := exec.Command("route", "print", "-4").Output()
+		if err != nil {
+			return nil, err
+		}
+		return parseWindowsRoutes(string(b))
+	}
+	return nil, nil
+}
+
+// Parse /proc/net/route, where addresses are little-endian hex, e.g.
+//
+//	Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+//	tun0	0000080A	00000000	0001	0	0	0	0000FFFF	0	0	0
+func parseLinuxRoutes(out string) ([]hostNet, error) {
+	routes := []hostNet{}
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 8 || fields[0] == "Iface" {
+			continue
+		}
+		dst, err := parseHexIPv4(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		mask, err := parseHexIPv4(fields[7])
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, hostNet{
+			Net:    net.IPNet{IP: dst, Mask: net.IPMask(mask.To4())},
+			Source: "route via " + fields[0],
+		})
+	}
+	return routes, s.Err()
+}
+
+func parseHexIPv4(s string) (net.IP, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+	return ip.To16(), nil
+}
+
+// Parse `netstat -rn -f inet`, where destinations drop trailing zero octets:
+//
+//	Destination        Gateway            Flags        Refs      Use   Netif Expire
+//	10/8               10.8.0.1           UGSc            0        0   utun1
+//	192.168.59         link#8             UC              2        0 vboxnet0
+func parseBSDRoutes(out string) ([]hostNet, error) {
+	routes := []hostNet{}
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 || fields[0] == "default" || fields[0][0] < '0' || fields[0][0] > '9' {
+			continue
+		}
+		dst := fields[0]
+		ones := -1
+		if i := strings.Index(dst, "/"); i >= 0 {
+			n, err := strconv.Atoi(dst[i+1:])
+			if err != nil {
+				continue
+			}
+			ones, dst = n, dst[:i]
+		}
+		octets := strings.Split(dst, ".")
+		if len(octets) > 4 {
+			continue
+		}
+		if ones < 0 {
+			ones = 8 * len(octets)
+		}
+		for len(octets) < 4 {
+			octets = append(octets, "0")
+		}
+		ip := net.ParseIP(strings.Join(octets, "."))
+		if ip == nil {
+			continue
+		}
+		mask := net.CIDRMask(ones, 32)
+		via := fields[1]
+		if len(fields) >= 6 {
+			via = fields[5]
+		}
+		routes = append(routes, hostNet{
+			Net:    net.IPNet{IP: ip.Mask(mask), Mask: mask},
+			Source: "route via " + via,
+		})
+	}
+	return routes, s.Err()
+}
+
+// Parse `route print -4`:
+//
+//	Network Destination        Netmask          Gateway       Interface  Metric
+//	       10.8.0.0      255.255.0.0         10.8.0.1       10.8.0.6     30
+func parseWindowsRoutes(out string) ([]hostNet, error) {
+	routes := []hostNet{}
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 5 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		mask := net.ParseIP(fields[1])
+		if ip == nil || mask == nil || ip.To4() == nil || mask.To4() == nil {
+			continue
+		}
+		m := net.IPMask(mask.To4())
+		routes = append(routes, hostNet{
+			Net:    net.IPNet{IP: ip.Mask(m), Mask: m},
+			Source: "route via " + fields[2],
+		})
+	}
+	return routes, s.Err()
+}
+
+func netsOverlap(a, b net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Check that the host-only network given by hostIP and mask does not collide
+// with a network the host already reaches, e.g. through a VPN. The check is
+// best-effort: it is skipped with a warning when the host networks can't be
+// listed, e.g. without netstat.
+func checkHostOnlySubnet(hostIP net.IP, mask net.IPMask) error {
+	nets, err := hostNetworks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not checking that the host-only network is free: %s\n", err)
+		return nil
+	}
+	return subnetConflict(nets, hostIP, mask)
+}
+
+// A host interface that already has exactly hostIP is the host-only
+// interface of a previous `init` and is fine to reuse.
+func subnetConflict(nets []hostNet, hostIP net.IP, mask net.IPMask) error {
+	subnet := net.IPNet{IP: hostIP.Mask(mask), Mask: mask}
+	for _, n := range nets {
+		if n.IP != nil && n.IP.Equal(hostIP) && n.Net.Mask.String() == mask.String() {
+			return nil
+		}
+	}
+	for _, n := range nets {
+		if netsOverlap(subnet, n.Net) {
+			return fmt.Errorf("host-only network %s overlaps %s (%s)", subnet.String(), n.Net.String(), n.Source)
+		}
+	}
+	return nil
+}
+
+// Pick the first /24 of the comma-separated CIDR list pool that is free on
+// the host. A preferred network (e.g. the one picked by a previous `init`) is
+// tried first.
+func pickHostOnlySubnet(pool string, preferred net.IP) (net.IP, error) {
+	nets, err := hostNetworks()
+	if err != nil {
+		return nil, err
+	}
+	return firstFreeSubnet(nets, pool, preferred)
+}
+
+func firstFreeSubnet(nets []hostNet, pool string, preferred net.IP) (net.IP, error) {
+	mask := net.CIDRMask(24, 32)
+	free := func(base net.IP) bool {
+		return subnetConflict(nets, hostOnlyIP(base, hostIPOffset), mask) == nil
+	}
+
+	if preferred != nil && free(preferred.Mask(mask)) {
+		return preferred.Mask(mask), nil
+	}
+	for _, cidr := range strings.Split(pool, ",") {
+		_, ipnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet pool %q: %s", pool, err)
+		}
+		if ones, bits := ipnet.Mask.Size(); bits != 32 || ones > 24 {
+			return nil, fmt.Errorf("invalid subnet pool %q: %s is not an IPv4 network of /24 or larger", pool, ipnet)
+		}
+		for base := ipnet.IP.To4(); ipnet.Contains(base); base = nextSubnet(base) {
+			if free(base) {
+				return base, nil
+			}
+			if base[0] == 255 && base[1] == 255 && base[2] == 255 {
+				break
+			}
+		}
+	}
+	return nil, fmt.Errorf("no free /24 network left in %s", pool)
+}
+
+// Host addresses within a host-only /24, matching the historical
+// 192.168.59.0/24 defaults.
+const (
+	hostIPOffset  = 3
+	dhcpIPOffset  = 99
+	lowerIPOffset = 103
+	upperIPOffset = 254
+)
+
+func hostOnlyIP(base net.IP, offset byte) net.IP {
+	b := base.To4()
+	return net.IPv4(b[0], b[1], b[2], offset)
+}
+
+func nextSubnet(base net.IP) net.IP {
+	b := base.To4()
+	n := binary.BigEndian.Uint32(b) + 1<<8
+	next := make(net.IP, 4)
+	binary.BigEndian.PutUint32(next, n)
+	return next
+}
+
+// Configure the host-only network settings of B2D for the /24 at base.
+func setHostOnlySubnet(base net.IP) {
+	B2D.HostIP = hostOnlyIP(base, hostIPOffset)
+	B2D.NetMask = net.CIDRMask(24, 32)
+	B2D.DHCPIP = hostOnlyIP(base, dhcpIPOffset)
+	B2D.LowerIP = hostOnlyIP(base, lowerIPOffset)
+	B2D.UpperIP = hostOnlyIP(base, upperIPOffset)
+}
+
+// Resolve --hostip=auto: pick a free subnet (keeping the one recorded in the
+// per-VM profile if it is still free), derive the DHCP settings from it and
+// record the choice.
+func autoHostOnlySubnet() error {
+	profile, err := loadVMProfile()
+	if err != nil {
+		return err
+	}
+	base, err := pickHostOnlySubnet(B2D.SubnetPool, profile.HostIP)
+	if err != nil {
+		return err
+	}
+	setHostOnlySubnet(base)
+	profile.HostIP = B2D.HostIP
+	profile.NetMask = B2D.NetMask
+	profile.DHCPIP = B2D.DHCPIP
+	profile.LowerIP = B2D.LowerIP
+	profile.UpperIP = B2D.UpperIP
+	return profile.save()
+}
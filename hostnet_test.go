@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseLinuxRoutes(t *testing.T) {
+	out := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0101A8C0	0003	0	0	0	00000000	0	0	0
+tun0	0000080A	00000000	0001	0	0	0	0000FFFF	0	0	0
+`
+	routes, err := parseLinuxRoutes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %+v", routes)
+	}
+	if got := routes[1].Net.String(); got != "10.8.0.0/16" {
+		t.Errorf("got %s, want 10.8.0.0/16", got)
+	}
+	if routes[1].Source != "route via tun0" {
+		t.Errorf("unexpected source %q", routes[1].Source)
+	}
+}
+
+func TestParseBSDRoutes(t *testing.T) {
+	out := `Routing tables
+
+Internet:
+Destination        Gateway            Flags        Refs      Use   Netif Expire
+default            192.168.1.1        UGSc           84        0     en0
+10/8               10.8.0.1           UGSc            0        0   utun1
+127                127.0.0.1          UCS             0        0     lo0
+192.168.59         link#8             UC              2        0 vboxnet0
+192.168.1.1/32     link#4             UCS             1        0     en0
+`
+	routes, err := parseBSDRoutes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "127.0.0.0/8", "192.168.59.0/24", "192.168.1.1/32"}
+	if len(routes) != len(want) {
+		t.Fatalf("expected %d routes, got %+v", len(want), routes)
+	}
+	for i, w := range want {
+		if got := routes[i].Net.String(); got != w {
+			t.Errorf("route %d: got %s, want %s", i, got, w)
+		}
+	}
+	if routes[0].Source != "route via utun1" {
+		t.Errorf("unexpected source %q", routes[0].Source)
+	}
+}
+
+func TestParseWindowsRoutes(t *testing.T) {
+	out := `===========================================================================
+IPv4 Route Table
+===========================================================================
+Active Routes:
+Network Destination        Netmask          Gateway       Interface  Metric
+          0.0.0.0          0.0.0.0      192.168.1.1    192.168.1.5     25
+         10.8.0.0      255.255.0.0         10.8.0.1       10.8.0.6     30
+===========================================================================
+`
+	routes, err := parseWindowsRoutes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[1].Net.String() != "10.8.0.0/16" {
+		t.Fatalf("unexpected routes %+v", routes)
+	}
+}
+
+func TestNetsOverlap(t *testing.T) {
+	parse := func(s string) net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *n
+	}
+	for _, tt := range []struct {
+		a, b    string
+		overlap bool
+	}{
+		{"192.168.59.0/24", "192.168.0.0/16", true},
+		{"192.168.59.0/24", "192.168.59.10/32", true},
+		{"192.168.59.0/24", "192.168.60.0/24", false},
+		{"192.168.59.0/24", "10.0.0.0/8", false},
+	} {
+		if got := netsOverlap(parse(tt.a), parse(tt.b)); got != tt.overlap {
+			t.Errorf("%s vs %s: got %v, want %v", tt.a, tt.b, got, tt.overlap)
+		}
+	}
+}
+
+func TestFirstFreeSubnet(t *testing.T) {
+	_, vpn, _ := net.ParseCIDR("192.168.59.0/24")
+	_, lan, _ := net.ParseCIDR("192.168.0.0/23")
+	nets := []hostNet{
+		{Net: *vpn, Source: "route via utun0"},
+		{IP: net.ParseIP("192.168.0.10"), Net: *lan, Source: "interface en0"},
+	}
+	pool := "192.168.59.0/24,192.168.0.0/16"
+
+	base, err := firstFreeSubnet(nets, pool, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := net.ParseIP("192.168.2.0"); !base.Equal(want) {
+		t.Errorf("got %s, want %s", base, want)
+	}
+
+	base, err = firstFreeSubnet(nets, pool, net.ParseIP("192.168.77.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := net.ParseIP("192.168.77.0"); !base.Equal(want) {
+		t.Errorf("preferred: got %s, want %s", base, want)
+	}
+
+	if _, err := firstFreeSubnet(nets, "192.168.59.0/24", nil); err == nil {
+		t.Error("expected an error for an exhausted pool")
+	}
+}
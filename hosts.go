@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Markers of the hosts file block managed for a VM, e.g.
+//
+//	# BEGIN boot2docker boot2docker-vm
+//	192.168.59.103	boot2docker-vm.local
+//	# END boot2docker boot2docker-vm
+const (
+	hostsBlockBegin = "# BEGIN boot2docker "
+	hostsBlockEnd   = "# END boot2docker "
+)
+
+// How long to wait for another boot2docker process to release the hosts file
+// lock, and after how long a lock is considered stale.
+const (
+	hostsLockWait  = 5 * time.Second
+	hostsLockStale = 30 * time.Second
+)
+
+func defaultHostsFile() string {
+	if runtime.GOOS == "windows" {
+		root := os.Getenv("SystemRoot")
+		if root == "" {
+			root = `C:\Windows`
+		}
+		return filepath.Join(root, "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// Host name of the VM in the hosts file, <vm>.local unless set explicitly.
+func vmHostname() string {
+	if B2D.Hostname != "" {
+		return B2D.Hostname
+	}
+	return B2D.VM + ".local"
+}
+
+// Returned when the hosts file cannot be written by the current user.
+type hostsPermissionError struct {
+	path string
+	line string
+}
+
+func (e hostsPermissionError) Error() string {
+	how := "run boot2docker with sudo"
+	if runtime.GOOS == "windows" {
+		how = "run boot2docker as Administrator"
+	}
+	if e.line == "" {
+		return fmt.Sprintf("no permission to update %s: %s, or remove the boot2docker block manually", e.path, how)
+	}
+	return fmt.Sprintf("no permission to update %s: %s, or add %q manually", e.path, how, e.line)
+}
+
+// Replace the block of vm in the hosts file content by lines. Without lines,
+// the block is removed.
+func setHostsBlock(content, vm string, lines []string) string {
+	return setMarkedBlock(content, hostsBlockBegin+vm, hostsBlockEnd+vm, lines)
+}
+
+// Replace the block delimited by the begin and end marker lines in content
+// by lines, appending it if missing. Without lines, the block is removed.
+func setMarkedBlock(content, begin, end string, lines []string) string {
+	eol := "\n"
+	if strings.Contains(content, "\r\n") {
+		eol = "\r\n"
+	}
+
+	kept := []string{}
+	found, inBlock := false, false
+	for _, line := range strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n") {
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == begin:
+			found, inBlock = true, true
+		case trimmed == end && inBlock:
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+	if !found && len(lines) == 0 {
+		return content
+	}
+	for len(kept) > 0 && kept[len(kept)-1] == "" {
+		kept = kept[:len(kept)-1]
+	}
+
+	if len(lines) > 0 {
+		kept = append(kept, begin)
+		kept = append(kept, lines...)
+		kept = append(kept, end)
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return strings.Join(kept, eol) + eol
+}
+
+// Point hostname at ip in the hosts file at path. Returns whether the file
+// changed.
+func setHostsEntry(path, vm, ip, hostname string) (bool, error) {
+	line := ip + "\t" + hostname
+	return updateHostsFile(path, vm, []string{line}, line)
+}
+
+// Remove the block of vm from the hosts file at path. Returns whether the
+// file changed.
+func removeHostsEntry(path, vm string) (bool, error) {
+	return updateHostsFile(path, vm, nil, "")
+}
+
+func updateHostsFile(path, vm string, lines []string, manual string) (bool, error) {
+	// Check without the lock first, so that nothing needs to be written
+	// (nor privileges be required) when the block is already up to date.
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if setHostsBlock(string(b), vm, lines) == string(b) {
+		return false, nil
+	}
+
+	unlock, err := lockHostsFile(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			return false, hostsPermissionError{path, manual}
+		}
+		return false, err
+	}
+	defer unlock()
+
+	// Re-read, another process may have changed the file meanwhile.
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return false, err
+	}
+	content := setHostsBlock(string(b), vm, lines)
+	if content == string(b) {
+		return false, nil
+	}
+	// Write in place rather than renaming a new file over it, which would
+	// break a symlinked hosts file and lose its ownership.
+	if err := ioutil.WriteFile(path, []byte(content), fi.Mode()); err != nil {
+		if os.IsPermission(err) {
+			return false, hostsPermissionError{path, manual}
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Take the lock guarding the hosts file at path against concurrent updates
+// by other boot2docker processes. The returned func releases it.
+func lockHostsFile(path string) (func(), error) {
+	lock := path + ".boot2docker-lock"
+	deadline := time.Now().Add(hostsLockWait)
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(lock); err == nil && time.Since(fi.ModTime()) > hostsLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", lock)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Update the hosts file entry of the VM to ip when the hosts integration is
+// enabled. Failures are reported but not fatal.
+func syncHostsEntry(ip string) {
+	if !B2D.Hosts || ip == "" {
+		return
+	}
+	changed, err := setHostsEntry(B2D.HostsFile, B2D.VM, ip, vmHostname())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update %s: %s\n", B2D.HostsFile, err)
+		return
+	}
+	if changed {
+		fmt.Fprintf(os.Stderr, "Updated %s: %s is at %s\n", B2D.HostsFile, vmHostname(), ip)
+	}
+}
+
+// Remove the hosts file entry of the VM, if any. Failures are reported but
+// not fatal.
+func clearHostsEntry() {
+	changed, err := removeHostsEntry(B2D.HostsFile, B2D.VM)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update %s: %s\n", B2D.HostsFile, err)
+		}
+		return
+	}
+	if changed {
+		fmt.Fprintf(os.Stderr, "Removed %s from %s\n", vmHostname(), B2D.HostsFile)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testHosts = `127.0.0.1	localhost
+::1	localhost
+`
+
+func writeTestHosts(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "b2d-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func readTestHosts(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestHostsEntry(t *testing.T) {
+	path, cleanup := writeTestHosts(t, testHosts)
+	defer cleanup()
+
+	steps := []struct {
+		ip      string // "" removes the entry
+		changed bool
+		want    string
+	}{
+		{"192.168.59.103", true, testHosts + "# BEGIN boot2docker boot2docker-vm\n192.168.59.103\tboot2docker-vm.local\n# END boot2docker boot2docker-vm\n"},
+		{"192.168.59.103", false, testHosts + "# BEGIN boot2docker boot2docker-vm\n192.168.59.103\tboot2docker-vm.local\n# END boot2docker boot2docker-vm\n"},
+		{"192.168.59.104", true, testHosts + "# BEGIN boot2docker boot2docker-vm\n192.168.59.104\tboot2docker-vm.local\n# END boot2docker boot2docker-vm\n"},
+		{"", true, testHosts},
+		{"", false, testHosts},
+	}
+	for i, s := range steps {
+		var changed bool
+		var err error
+		if s.ip != "" {
+			changed, err = setHostsEntry(path, "boot2docker-vm", s.ip, "boot2docker-vm.local")
+		} else {
+			changed, err = removeHostsEntry(path, "boot2docker-vm")
+		}
+		if err != nil {
+			t.Fatalf("step %d: %s", i, err)
+		}
+		if changed != s.changed {
+			t.Errorf("step %d: changed = %v, want %v", i, changed, s.changed)
+		}
+		if got := readTestHosts(t, path); got != s.want {
+			t.Errorf("step %d: got\n%s\nwant\n%s", i, got, s.want)
+		}
+	}
+	if _, err := os.Stat(path + ".boot2docker-lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestHostsEntryKeepsOtherBlocks(t *testing.T) {
+	other := "# BEGIN boot2docker other-vm\n192.168.60.103\tother-vm.local\n# END boot2docker other-vm\n"
+	path, cleanup := writeTestHosts(t, testHosts+other)
+	defer cleanup()
+
+	if _, err := setHostsEntry(path, "boot2docker-vm", "192.168.59.103", "docker.local"); err != nil {
+		t.Fatal(err)
+	}
+	want := testHosts + other + "# BEGIN boot2docker boot2docker-vm\n192.168.59.103\tdocker.local\n# END boot2docker boot2docker-vm\n"
+	if got := readTestHosts(t, path); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if _, err := removeHostsEntry(path, "boot2docker-vm"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestHosts(t, path); got != testHosts+other {
+		t.Errorf("got\n%s\nwant\n%s", got, testHosts+other)
+	}
+}
+
+func TestHostsEntryCRLF(t *testing.T) {
+	path, cleanup := writeTestHosts(t, "127.0.0.1 localhost\r\n")
+	defer cleanup()
+
+	if _, err := setHostsEntry(path, "boot2docker-vm", "192.168.59.103", "boot2docker-vm.local"); err != nil {
+		t.Fatal(err)
+	}
+	want := "127.0.0.1 localhost\r\n# BEGIN boot2docker boot2docker-vm\r\n192.168.59.103\tboot2docker-vm.local\r\n# END boot2docker boot2docker-vm\r\n"
+	if got := readTestHosts(t, path); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHostsEntryStaleLock(t *testing.T) {
+	path, cleanup := writeTestHosts(t, testHosts)
+	defer cleanup()
+
+	lock := path + ".boot2docker-lock"
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * hostsLockStale)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setHostsEntry(path, "boot2docker-vm", "192.168.59.103", "boot2docker-vm.local"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHostsEntryPermission(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	path, cleanup := writeTestHosts(t, testHosts)
+	defer cleanup()
+	if err := os.Chmod(path, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Dir(path), 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Dir(path), 0755)
+
+	_, err := setHostsEntry(path, "boot2docker-vm", "192.168.59.103", "boot2docker-vm.local")
+	if _, ok := err.(hostsPermissionError); !ok {
+		t.Errorf("got %v, want a hostsPermissionError", err)
+	}
+}
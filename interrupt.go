@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The step of the current command in progress, reported when it is
+// interrupted.
+var progress struct {
+	sync.Mutex
+	step string
+}
+
+// Record step as in progress, or nothing when empty.
+func setProgress(format string, args ...interface{}) {
+	progress.Lock()
+	defer progress.Unlock()
+	progress.step = fmt.Sprintf(format, args...)
+}
+
+func currentProgress() string {
+	progress.Lock()
+	defer progress.Unlock()
+	return progress.step
+}
+
+// Context of the command, cancelled on the first SIGINT or SIGTERM. A second
+// signal gets the default behaviour, i.e. kills the program.
+func signalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-c:
+			signal.Stop(c)
+			fmt.Fprintf(os.Stderr, "\nReceived %s, cancelling (again to kill)...\n", sig)
+			cancel()
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(c)
+		close(done)
+		cancel()
+	}
+}
+
+// Message for err returned by a command run with ctx, telling what was in
+// progress if the command was interrupted. Commands like `ports --watch`
+// finish successfully when interrupted.
+func interruptedError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	msg := "Interrupted"
+	if step := currentProgress(); step != "" {
+		msg += " while " + step
+	}
+	if err != context.Canceled {
+		msg += ": " + err.Error()
+	}
+	return errors.New(msg)
+}
+
+// Run op, described by what, bounded by a timeout in seconds (0 for none).
+// It stays recorded as in progress unless it succeeds.
+func runTimed(ctx context.Context, seconds uint, what string, op func(context.Context) error) error {
+	setProgress("%s", what)
+	if seconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+		defer cancel()
+	}
+	if err := op(ctx); err != nil {
+		if err == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %ds %s", seconds, what)
+		}
+		return err
+	}
+	setProgress("")
+	return nil
+}
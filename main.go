@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+
+	flag "github.com/ogier/pflag"
 )
 
 // The following vars will be injected during the build process.
@@ -55,6 +58,13 @@ func run() error {
 		return fmt.Errorf("config error: %v\n", err)
 	}
 
+	ctx, stop := signalContext()
+	defer stop()
+	return interruptedError(ctx, runCmd(ctx, flags))
+}
+
+// Run the command of flags, interrupted by the cancellation of ctx.
+func runCmd(ctx context.Context, flags *flag.FlagSet) error {
 	switch cmd := flags.Arg(0); cmd {
 	case "download":
 		return cmdDownload()
@@ -62,34 +72,54 @@ func run() error {
 		return cmdConfig()
 	case "init":
 		printDeprecationWarning()
-		return cmdInit()
+		return cmdInit(ctx)
 	case "up", "start", "boot", "resume":
 		printDeprecationWarning()
-		return cmdUp()
+		return cmdUp(ctx)
 	case "save", "suspend":
-		return cmdSave()
+		return cmdSave(ctx)
 	case "down", "halt", "stop":
-		return cmdStop()
+		return cmdStop(ctx)
 	case "poweroff":
-		return cmdPoweroff()
+		return cmdPoweroff(ctx)
 	case "restart":
-		return cmdRestart()
+		return cmdRestart(ctx)
 	case "reset":
-		return cmdReset()
+		return cmdReset(ctx)
 	case "delete", "destroy":
-		return cmdDelete()
+		return cmdDelete(ctx)
 	case "info":
-		return cmdInfo()
+		return cmdInfo(ctx)
 	case "shellinit", "socket":
-		return cmdShellInit()
+		return cmdShellInit(ctx)
 	case "status":
-		return cmdStatus()
+		return cmdStatus(ctx)
+	case "ls", "list":
+		return cmdList(ctx)
 	case "ssh":
-		return cmdSSH()
+		return cmdSSH(ctx)
+	case "console":
+		return cmdConsole(ctx)
+	case "logs":
+		return cmdLogs(ctx)
 	case "ip":
-		return cmdIP()
+		return cmdIP(ctx)
+	case "wait":
+		return cmdWait(ctx)
+	case "port":
+		return cmdPort(ctx, flags.Args()[1:])
+	case "ports":
+		return cmdPorts(ctx)
+	case "network":
+		return cmdNetwork(ctx, flags.Args()[1:])
+	case "daemon":
+		return cmdDaemon(ctx, flags.Args()[1:])
+	case "provision":
+		return cmdProvision(ctx)
+	case "certs":
+		return cmdCerts(ctx, flags.Args()[1:])
 	case "upgrade":
-		return cmdUpgrade()
+		return cmdUpgrade(ctx)
 	case "version":
 		// Version is now printed by the call to config()
 		return nil
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// NAT port forwarding rules are added to the first (NAT) NIC.
+const natNIC = 1
+
+// Rules boot2docker relies on itself; `port rm` refuses to touch them.
+var reservedPortRules = map[string]bool{"ssh": true, "docker": true}
+
+// Manage the NAT port forwarding rules of the VM.
+func cmdPort(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Usage: port {add <name> tcp|udp [<hostip>:]<hostport>:<guestport>|rm <name>|ls}")
+	}
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil {
+		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
+	}
+	profile, err := loadVMProfile()
+	if err != nil {
+		return fmt.Errorf("Failed to read profile of machine %q: %s", B2D.VM, err)
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "add":
+		if len(args) != 3 {
+			return fmt.Errorf("Usage: port add <name> tcp|udp [<hostip>:]<hostport>:<guestport>")
+		}
+		name := args[0]
+		rule, err := parsePortRule(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		if err := checkHostPort(ctx, m, name, rule); err != nil {
+			return err
+		}
+		if err := m.AddNATPF(ctx, natNIC, name, rule); err != nil {
+			return fmt.Errorf("Failed to add port forwarding rule %q: %s", name, err)
+		}
+		profile.Ports[name] = rule
+		if err := profile.save(); err != nil {
+			return fmt.Errorf("Failed to save profile of machine %q: %s", B2D.VM, err)
+		}
+		fmt.Printf("Forwarding %s\n", rule)
+	case "rm", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("Usage: port rm <name>")
+		}
+		name := args[0]
+		if reservedPortRules[name] {
+			return fmt.Errorf("Port forwarding rule %q is required by boot2docker", name)
+		}
+		_, onVM := m.GetNATPFRules(natNIC)[name]
+		_, inProfile := profile.Ports[name]
+		if !onVM && !inProfile {
+			return fmt.Errorf("No port forwarding rule named %q", name)
+		}
+		if onVM {
+			if err := m.DelNATPF(ctx, natNIC, name); err != nil {
+				return fmt.Errorf("Failed to delete port forwarding rule %q: %s", name, err)
+			}
+		}
+		delete(profile.Ports, name)
+		if err := profile.save(); err != nil {
+			return fmt.Errorf("Failed to save profile of machine %q: %s", B2D.VM, err)
+		}
+	case "ls", "list":
+		return listPortRules(os.Stdout, m.GetNATPFRules(natNIC), profile)
+	default:
+		return unknownCommandError{cmd: "port " + cmd}
+	}
+	return nil
+}
+
+// Parse "tcp" and "[<hostip>:]<hostport>:<guestport>" into a forwarding rule.
+// Without an explicit host IP the port is only bound on localhost.
+func parsePortRule(proto, spec string) (driver.PFRule, error) {
+	rule := driver.PFRule{HostIP: net.ParseIP("127.0.0.1")}
+	switch p := driver.PFProto(strings.ToLower(proto)); p {
+	case driver.PFTCP, driver.PFUDP:
+		rule.Proto = p
+	default:
+		return rule, fmt.Errorf("Unknown protocol %q (expected tcp or udp)", proto)
+	}
+
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 2:
+	case 3:
+		if rule.HostIP = net.ParseIP(parts[0]); rule.HostIP == nil {
+			return rule, fmt.Errorf("Invalid host IP %q", parts[0])
+		}
+		parts = parts[1:]
+	default:
+		return rule, fmt.Errorf("Invalid port mapping %q (expected [<hostip>:]<hostport>:<guestport>)", spec)
+	}
+	hostPort, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || hostPort == 0 {
+		return rule, fmt.Errorf("Invalid host port %q", parts[0])
+	}
+	guestPort, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil || guestPort == 0 {
+		return rule, fmt.Errorf("Invalid guest port %q", parts[1])
+	}
+	rule.HostPort = uint16(hostPort)
+	rule.GuestPort = uint16(guestPort)
+	return rule, nil
+}
+
+// Check that the host side of rule is not used by another forwarding rule of
+// any known VM, nor by some other process on the host.
+func checkHostPort(ctx context.Context, m driver.Machine, name string, rule driver.PFRule) error {
+	if _, exists := m.GetNATPFRules(natNIC)[name]; exists {
+		return fmt.Errorf("Port forwarding rule %q already exists", name)
+	}
+
+	machines := []driver.Machine{m}
+	if names, err := driver.ListMachines(ctx, &B2D); err == nil {
+		for _, vm := range names {
+			if vm == m.GetName() {
+				continue
+			}
+			mc := B2D
+			mc.VM = vm
+			mc.Init = false
+			if other, err := driver.GetMachine(ctx, &mc); err == nil {
+				machines = append(machines, other)
+			}
+		}
+	}
+	for _, vm := range machines {
+		if err := checkRuleOverlap(vm.GetName(), vm.GetNATPFRules(natNIC), rule); err != nil {
+			return err
+		}
+	}
+	return checkHostPortFree(rule)
+}
+
+// Check that none of the forwarding rules of VM vm uses the host side of rule.
+func checkRuleOverlap(vm string, rules map[string]driver.PFRule, rule driver.PFRule) error {
+	for other, r := range rules {
+		if r.Proto == rule.Proto && r.HostPort == rule.HostPort && hostIPsOverlap(r.HostIP, rule.HostIP) {
+			return fmt.Errorf("Host port %d is already forwarded by rule %q of machine %q", rule.HostPort, other, vm)
+		}
+	}
+	return nil
+}
+
+// Check that no process on the host listens on the host side of rule.
+func checkHostPortFree(rule driver.PFRule) error {
+	host := ""
+	if rule.HostIP != nil {
+		host = rule.HostIP.String()
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(rule.HostPort)))
+	var l io.Closer
+	var err error
+	if rule.Proto == driver.PFUDP {
+		l, err = net.ListenPacket("udp", addr)
+	} else {
+		l, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("Host port %s/%d is not available: %s", rule.Proto, rule.HostPort, err)
+	}
+	return l.Close()
+}
+
+// Whether two rule host IPs can bind the same address. A nil or unspecified
+// IP matches every host interface.
+func hostIPsOverlap(a, b net.IP) bool {
+	if a == nil || b == nil || a.IsUnspecified() || b.IsUnspecified() {
+		return true
+	}
+	return a.Equal(b)
+}
+
+// List to out the rules of the VM along the ones of its profile not applied
+// yet, sorted by name.
+func listPortRules(out io.Writer, rules map[string]driver.PFRule, profile *vmProfile) error {
+	type entry struct {
+		Name      string `json:"Name" yaml:"Name"`
+		Proto     string `json:"Proto" yaml:"Proto"`
+		HostIP    string `json:"HostIP" yaml:"HostIP"`
+		HostPort  uint16 `json:"HostPort" yaml:"HostPort"`
+		GuestPort uint16 `json:"GuestPort" yaml:"GuestPort"`
+		Applied   bool   `json:"Applied" yaml:"Applied"` // present on the VM, not only in the profile
+	}
+	all := map[string]entry{}
+	add := func(name string, r driver.PFRule, applied bool) {
+		hostip := ""
+		if r.HostIP != nil {
+			hostip = r.HostIP.String()
+		}
+		all[name] = entry{name, string(r.Proto), hostip, r.HostPort, r.GuestPort, applied}
+	}
+	for name, r := range profile.Ports {
+		add(name, r, false)
+	}
+	for name, r := range rules {
+		add(name, r, true)
+	}
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]entry, 0, len(names))
+	for _, name := range names {
+		list = append(list, all[name])
+	}
+
+	return writeFormatted(out, outputFormat, list, func(w io.Writer) error {
+		fmt.Fprintln(w, "NAME\tPROTO\tHOST\tGUEST\t")
+		for _, e := range list {
+			note := ""
+			if !e.Applied {
+				note = "(not applied)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", e.Name, e.Proto, net.JoinHostPort(e.HostIP, strconv.Itoa(int(e.HostPort))), e.GuestPort, note)
+		}
+		return nil
+	})
+}
+
+// Add the profile's forwarding rules that are missing from the VM, e.g. after
+// it has been re-created. Failures are reported but not fatal.
+func applyProfilePorts(ctx context.Context, m driver.Machine) {
+	profile, err := loadVMProfile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read profile of machine %q: %s\n", B2D.VM, err)
+		return
+	}
+	existing := m.GetNATPFRules(natNIC)
+	for name, rule := range profile.Ports {
+		if _, ok := existing[name]; ok {
+			continue
+		}
+		if err := m.AddNATPF(ctx, natNIC, name, rule); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to restore port forwarding rule %q: %s\n", name, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+func TestParsePortRule(t *testing.T) {
+	for _, tt := range []struct {
+		proto, spec string
+		want        driver.PFRule
+		err         string
+	}{
+		{"tcp", "8080:80", driver.PFRule{Proto: driver.PFTCP, HostIP: net.ParseIP("127.0.0.1"), HostPort: 8080, GuestPort: 80}, ""},
+		{"UDP", "53:53", driver.PFRule{Proto: driver.PFUDP, HostIP: net.ParseIP("127.0.0.1"), HostPort: 53, GuestPort: 53}, ""},
+		{"tcp", "0.0.0.0:8080:80", driver.PFRule{Proto: driver.PFTCP, HostIP: net.ParseIP("0.0.0.0"), HostPort: 8080, GuestPort: 80}, ""},
+		{"tcp", "192.168.1.2:65535:1", driver.PFRule{Proto: driver.PFTCP, HostIP: net.ParseIP("192.168.1.2"), HostPort: 65535, GuestPort: 1}, ""},
+		{"sctp", "8080:80", driver.PFRule{}, `Unknown protocol "sctp" (expected tcp or udp)`},
+		{"", "8080:80", driver.PFRule{}, `Unknown protocol "" (expected tcp or udp)`},
+		{"tcp", "8080", driver.PFRule{}, `Invalid port mapping "8080" (expected [<hostip>:]<hostport>:<guestport>)`},
+		{"tcp", "1:2:3:4", driver.PFRule{}, `Invalid port mapping "1:2:3:4" (expected [<hostip>:]<hostport>:<guestport>)`},
+		{"tcp", ":8080:80", driver.PFRule{}, `Invalid host IP ""`},
+		{"tcp", "localhost:8080:80", driver.PFRule{}, `Invalid host IP "localhost"`},
+		{"tcp", "65536:80", driver.PFRule{}, `Invalid host port "65536"`},
+		{"tcp", "0:80", driver.PFRule{}, `Invalid host port "0"`},
+		{"tcp", "-1:80", driver.PFRule{}, `Invalid host port "-1"`},
+		{"tcp", "http:80", driver.PFRule{}, `Invalid host port "http"`},
+		{"tcp", "8080:", driver.PFRule{}, `Invalid guest port ""`},
+		{"tcp", "8080:70000", driver.PFRule{}, `Invalid guest port "70000"`},
+	} {
+		rule, err := parsePortRule(tt.proto, tt.spec)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parsePortRule(%q, %q): got error %v, want %q", tt.proto, tt.spec, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePortRule(%q, %q): %s", tt.proto, tt.spec, err)
+			continue
+		}
+		if rule.Proto != tt.want.Proto || !rule.HostIP.Equal(tt.want.HostIP) ||
+			rule.HostPort != tt.want.HostPort || rule.GuestPort != tt.want.GuestPort {
+			t.Errorf("parsePortRule(%q, %q) = %s, want %s", tt.proto, tt.spec, rule, tt.want)
+		}
+	}
+}
+
+func TestHostIPsOverlap(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want bool
+	}{
+		{"127.0.0.1", "127.0.0.1", true},
+		{"127.0.0.1", "192.168.1.2", false},
+		{"0.0.0.0", "127.0.0.1", true},
+		{"192.168.1.2", "0.0.0.0", true},
+		{"::", "127.0.0.1", true},
+		{"", "127.0.0.1", true},
+		{"127.0.0.1", "", true},
+		{"", "", true},
+		{"::1", "127.0.0.1", false},
+	} {
+		if got := hostIPsOverlap(net.ParseIP(tt.a), net.ParseIP(tt.b)); got != tt.want {
+			t.Errorf("hostIPsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestListPortRules(t *testing.T) {
+	saved := outputFormat
+	defer func() { outputFormat = saved }()
+
+	rules := map[string]driver.PFRule{
+		"web": {Proto: driver.PFTCP, HostIP: net.ParseIP("127.0.0.1"), HostPort: 8080, GuestPort: 80},
+		"ssh": {Proto: driver.PFTCP, HostPort: 2022, GuestPort: 22},
+	}
+	profile := &vmProfile{Ports: map[string]driver.PFRule{
+		"web": {Proto: driver.PFTCP, HostIP: net.ParseIP("127.0.0.1"), HostPort: 8080, GuestPort: 80},
+		"dns": {Proto: driver.PFUDP, HostIP: net.ParseIP("0.0.0.0"), HostPort: 5353, GuestPort: 53},
+	}}
+
+	for _, tt := range []struct {
+		format, want string
+	}{
+		{"", "NAME  PROTO  HOST            GUEST  \n" +
+			"dns   udp    0.0.0.0:5353    53     (not applied)\n" +
+			"ssh   tcp    :2022           22     \n" +
+			"web   tcp    127.0.0.1:8080  80     \n"},
+		{"{{range .}}{{.Name}}={{.Applied}} {{end}}", "dns=false ssh=true web=true \n"},
+	} {
+		outputFormat = tt.format
+		var buf bytes.Buffer
+		if err := listPortRules(&buf, rules, profile); err != nil {
+			t.Errorf("format %q: %s", tt.format, err)
+			continue
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("format %q: got %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
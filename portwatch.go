@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Name prefix of the forwarding rules managed by `boot2docker ports`.
+const autoPortPrefix = "auto-"
+
+// Value of the --watch flag.
+var watchPorts bool
+
+// Keeps the VM's NAT forwarding rules in sync with the ports published by
+// running containers, so that `docker run -p 8080:80` is reachable at
+// localhost:8080.
+type portWatcher struct {
+	m      driver.Machine
+	docker *dockerClient
+	rules  map[string]driver.PFRule // rules currently added by us
+}
+
+// Forward the ports published by running containers to localhost. With
+// --watch, keep following container events until interrupted and remove all
+// the rules on exit.
+func cmdPorts(ctx context.Context) error {
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil {
+		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
+	}
+	if m.GetState() != driver.Running {
+		return vmNotRunningError(B2D.VM)
+	}
+
+	socket, err := RequestSocketFromSSH(ctx, m)
+	if err != nil {
+		return fmt.Errorf("Error requesting socket: %s", err)
+	}
+	certPath, err := RequestCertsUsingSSH(m)
+	if err != nil {
+		return fmt.Errorf("Error copying certificates: %s", err)
+	}
+	docker, err := newDockerClient(socket, certPath)
+	if err != nil {
+		return fmt.Errorf("Error connecting to the Docker daemon: %s", err)
+	}
+
+	w := &portWatcher{m: m, docker: docker, rules: map[string]driver.PFRule{}}
+	// Take over rules left behind by a previous run, so stale ones get removed.
+	for name, rule := range m.GetNATPFRules(natNIC) {
+		if strings.HasPrefix(name, autoPortPrefix) {
+			w.rules[name] = rule
+		}
+	}
+
+	if !watchPorts {
+		return w.sync(ctx)
+	}
+
+	// Subscribe before the initial sync so no event is missed.
+	events, err := docker.open("/events")
+	if err != nil {
+		return fmt.Errorf("Error subscribing to Docker events: %s", err)
+	}
+	defer events.Close()
+	defer w.cleanup()
+
+	go func() {
+		<-ctx.Done()
+		events.Close() // unblocks the decoder below
+	}()
+
+	if err := w.sync(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Watching published container ports, press Ctrl-C to stop.\n")
+
+	dec := json.NewDecoder(events)
+	for {
+		var ev struct {
+			Status string `json:"status"`
+			ID     string `json:"id"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("Error reading Docker events: %s", err)
+		}
+		switch ev.Status {
+		case "start", "die", "destroy":
+			if err := w.sync(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+			}
+		}
+	}
+}
+
+// Add the rules for newly published ports and remove the ones whose
+// container is gone.
+func (w *portWatcher) sync(ctx context.Context) error {
+	var containers []struct {
+		ID    string `json:"Id"`
+		Ports []struct {
+			IP          string
+			PrivatePort uint16
+			PublicPort  uint16
+			Type        string
+		}
+	}
+	if err := w.docker.get("/containers/json", &containers); err != nil {
+		return fmt.Errorf("Error listing containers: %s", err)
+	}
+
+	want := map[string]driver.PFRule{}
+	for _, c := range containers {
+		id := c.ID
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		for _, p := range c.Ports {
+			if p.PublicPort == 0 {
+				continue
+			}
+			// Ports bound to a specific address in the VM (e.g. its
+			// loopback) are not reachable through the NAT interface.
+			if ip := net.ParseIP(p.IP); ip != nil && !ip.IsUnspecified() {
+				continue
+			}
+			proto := driver.PFProto(p.Type)
+			name := fmt.Sprintf("%s%s-%s-%d", autoPortPrefix, id, proto, p.PublicPort)
+			want[name] = driver.PFRule{
+				Proto:     proto,
+				HostIP:    net.ParseIP("127.0.0.1"),
+				HostPort:  p.PublicPort,
+				GuestPort: p.PublicPort,
+			}
+		}
+	}
+
+	for name, rule := range w.rules {
+		if _, ok := want[name]; ok {
+			continue
+		}
+		if err := w.m.DelNATPF(ctx, natNIC, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove port forwarding rule %q: %s\n", name, err)
+			continue
+		}
+		delete(w.rules, name)
+		fmt.Printf("Stopped forwarding %s\n", rule)
+	}
+	refreshed := false
+	for name, rule := range want {
+		if _, ok := w.rules[name]; ok {
+			continue
+		}
+		// Check new rules against the current ones of the VM rather than
+		// those at startup, as rules come and go while watching.
+		if !refreshed {
+			if err := w.m.Refresh(ctx); err != nil {
+				return fmt.Errorf("Failed to refresh machine %q: %s", w.m.GetName(), err)
+			}
+			refreshed = true
+		}
+		if err := w.checkPort(name, rule); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: not forwarding %s: %s\n", rule, err)
+			continue
+		}
+		if err := w.m.AddNATPF(ctx, natNIC, name, rule); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to add port forwarding rule %q: %s\n", name, err)
+			continue
+		}
+		w.rules[name] = rule
+		fmt.Printf("Forwarding %s\n", rule)
+	}
+	return nil
+}
+
+// Check that rule, named name, can be added to the VM: neither its name nor
+// its host port is used by another rule, nor the host port by some other
+// process on the host. Rules of other VMs only conflict once they are running,
+// which the host check catches.
+func (w *portWatcher) checkPort(name string, rule driver.PFRule) error {
+	rules := w.m.GetNATPFRules(natNIC)
+	if _, exists := rules[name]; exists {
+		return fmt.Errorf("Port forwarding rule %q already exists", name)
+	}
+	if err := checkRuleOverlap(w.m.GetName(), rules, rule); err != nil {
+		return err
+	}
+	// Rules added since the refresh are only known to the watcher.
+	if err := checkRuleOverlap(w.m.GetName(), w.rules, rule); err != nil {
+		return err
+	}
+	return checkHostPortFree(rule)
+}
+
+// Remove all the rules added by the watcher. It runs once the command is
+// interrupted, so not within its context.
+func (w *portWatcher) cleanup() {
+	ctx := context.Background()
+	for name, rule := range w.rules {
+		if err := w.m.DelNATPF(ctx, natNIC, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove port forwarding rule %q: %s\n", name, err)
+			continue
+		}
+		delete(w.rules, name)
+		fmt.Printf("Stopped forwarding %s\n", rule)
+	}
+}
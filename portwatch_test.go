@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Machine whose forwarding rules, like the VirtualBox ones, are only read
+// again on Refresh.
+type fakePortMachine struct {
+	driver.Machine
+	rules map[string]driver.PFRule // actual rules of the VM
+	seen  map[string]driver.PFRule // rules as of the last refresh
+}
+
+func newFakePortMachine(rules map[string]driver.PFRule) *fakePortMachine {
+	m := &fakePortMachine{rules: rules}
+	m.Refresh(context.Background())
+	return m
+}
+
+func (m *fakePortMachine) GetName() string { return "test-vm" }
+
+func (m *fakePortMachine) Refresh(ctx context.Context) error {
+	m.seen = map[string]driver.PFRule{}
+	for name, rule := range m.rules {
+		m.seen[name] = rule
+	}
+	return nil
+}
+
+func (m *fakePortMachine) GetNATPFRules(n int) map[string]driver.PFRule {
+	return m.seen
+}
+
+func (m *fakePortMachine) AddNATPF(ctx context.Context, n int, name string, rule driver.PFRule) error {
+	if _, exists := m.rules[name]; exists {
+		return fmt.Errorf("rule %q exists", name)
+	}
+	m.rules[name] = rule
+	return nil
+}
+
+func (m *fakePortMachine) DelNATPF(ctx context.Context, n int, name string) error {
+	delete(m.rules, name)
+	return nil
+}
+
+// A host port nothing listens on.
+func freePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestPortWatcherSync(t *testing.T) {
+	var containers string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, containers)
+	}))
+	defer srv.Close()
+	docker, err := newDockerClient("tcp://"+strings.TrimPrefix(srv.URL, "http://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, taken := freePort(t), freePort(t)
+	auto := fmt.Sprintf("auto-aaaaaaaaaaaa-tcp-%d", port)
+	rule := driver.PFRule{Proto: driver.PFTCP, HostIP: net.ParseIP("127.0.0.1"), HostPort: port, GuestPort: port}
+	m := newFakePortMachine(map[string]driver.PFRule{
+		auto:     rule, // left behind by a previous run
+		"manual": {Proto: driver.PFTCP, HostPort: taken, GuestPort: 80},
+	})
+	w := &portWatcher{m: m, docker: docker, rules: map[string]driver.PFRule{auto: rule}}
+	ctx := context.Background()
+
+	// The taken over rule goes away with its container.
+	containers = `[]`
+	if err := w.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.rules[auto]; ok || len(w.rules) != 0 {
+		t.Fatalf("stale rule kept: VM %v, watcher %v", m.rules, w.rules)
+	}
+
+	// It is added again once the container is back, although the rules seen
+	// at startup still have it.
+	containers = fmt.Sprintf(`[{"Id": "aaaaaaaaaaaaaaaa", "Ports": [
+		{"IP": "0.0.0.0", "PrivatePort": 80, "PublicPort": %d, "Type": "tcp"},
+		{"IP": "127.0.0.1", "PrivatePort": 81, "PublicPort": 8081, "Type": "tcp"}]}]`, port)
+	if err := w.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.rules[auto]; !ok || len(w.rules) != 1 {
+		t.Fatalf("rule not added back: VM %v, watcher %v", m.rules, w.rules)
+	}
+
+	// A port already forwarded by another rule is not.
+	containers = fmt.Sprintf(`[{"Id": "bbbbbbbbbbbbbbbb", "Ports": [
+		{"IP": "0.0.0.0", "PrivatePort": 80, "PublicPort": %d, "Type": "tcp"}]}]`, taken)
+	if err := w.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.rules) != 0 || len(m.rules) != 1 {
+		t.Errorf("conflicting rule added: VM %v, watcher %v", m.rules, w.rules)
+	}
+}
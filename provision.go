@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Where the provisioning files go in the VM.
+const vmProvisionDir = "/var/lib/boot2docker/provision"
+
+// Shell script run as root in the VM to apply the provisioning files uploaded
+// to the persistent disk:
+//   - certs/*.pem and certs/*.crt are installed as CA certificates (the ones
+//     already in /var/lib/boot2docker/certs were loaded at boot, so they
+//     don't count as changed),
+//   - files/ is copied into /var/lib/boot2docker (e.g. files/bootlocal.sh),
+//   - the top-level *.sh scripts are run in order, each only once per
+//     content (their checksums are recorded in .provisioned).
+const provisionRunner = `
+set -e
+dir=` + vmProvisionDir + `
+state=/var/lib/boot2docker/.provisioned
+[ -d $dir ] || exit 0
+touch $state
+
+if [ -d $dir/certs ]; then
+	mkdir -p /var/lib/boot2docker/certs
+	for cert in $dir/certs/*.pem $dir/certs/*.crt; do
+		[ -f "$cert" ] || continue
+		name=$(basename "$cert")
+		dest="/var/lib/boot2docker/certs/${name%.*}.pem"
+		cmp -s "$cert" "$dest" && continue
+		cp "$cert" "$dest"
+		echo "Installed CA certificate $name"
+		if ! grep -qF "$(sed -n 2p "$cert")" /etc/ssl/certs/ca-certificates.crt; then
+			cat "$cert" >> /etc/ssl/certs/ca-certificates.crt
+			echo "` + certsChangedMarker + `"
+		fi
+	done
+fi
+
+if [ -d $dir/files ]; then
+	cp -R $dir/files/. /var/lib/boot2docker/
+fi
+
+for script in $dir/*.sh; do
+	[ -f "$script" ] || continue
+	sum=$(md5sum "$script" | cut -d' ' -f1)
+	grep -q "^$sum " $state && continue
+	echo "Running $(basename "$script")"
+	sh "$script"
+	echo "$sum $(basename "$script")" >> $state
+done
+`
+
+// Check that the --provision directory can be packed.
+func checkProvisionDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// Apply the provisioning files present in the VM. Returns whether the Docker
+// daemon needs a restart.
+func runProvisioning(m driver.Machine) (bool, error) {
+	restart, err := runVMScript(m, "sudo sh -s", strings.NewReader(provisionRunner))
+	if err != nil {
+		return restart, fmt.Errorf("provisioning failed: %s", err)
+	}
+	return restart, nil
+}
+
+// Upload the --provision directory to the VM, replacing the previous one, and
+// apply it.
+func cmdProvision(ctx context.Context) error {
+	if B2D.Provision == "" {
+		return fmt.Errorf("Usage: provision --provision=<dir>")
+	}
+	if err := checkProvisionDir(B2D.Provision); err != nil {
+		return fmt.Errorf("Invalid provisioning directory: %s", err)
+	}
+	m, err := driver.GetMachine(ctx, &B2D)
+	if err != nil {
+		return fmt.Errorf("Failed to get machine %q: %s", B2D.VM, err)
+	}
+	if m.GetState() != driver.Running {
+		return vmNotRunningError(B2D.VM)
+	}
+
+	if err := uploadProvision(m, B2D.Provision); err != nil {
+		return err
+	}
+
+	restart, err := runProvisioning(m)
+	if err != nil {
+		return err
+	}
+	if restart {
+		fmt.Println("Restarting the Docker daemon...")
+		return restartDockerDaemon(ctx, m)
+	}
+	return nil
+}
+
+// Upload the provisioning directory dir to the VM, replacing the previous one.
+// It is not written onto the disk by `init`, as boot2docker only reads the
+// first 4 KiB of it.
+func uploadProvision(m driver.Machine, dir string) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := writeTarDir(tw, dir); err != nil {
+		return fmt.Errorf("Failed to pack %s: %s", dir, err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("Failed to pack %s: %s", dir, err)
+	}
+	cmd := getSSHCommand(m, fmt.Sprintf("sudo rm -rf %[1]s && sudo mkdir -p %[1]s && sudo tar xf - -C %[1]s", vmProvisionDir))
+	cmd.Stdin = &buf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to upload %s: %s", dir, err)
+	}
+	return nil
+}
+
+// Add the directories and regular files under dir to tw, named by their path
+// relative to dir. Other file types are skipped.
+func writeTarDir(tw *tar.Writer, dir string) error {
+	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(".", filepath.ToSlash(rel))
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// Upload the provisioning directory recorded by `init`, if the VM has none
+// yet, i.e. on its first `up`.
+func uploadInitProvision(m driver.Machine) error {
+	p, err := loadVMProfile()
+	if err != nil {
+		return err
+	}
+	if p.Provision == "" {
+		return nil
+	}
+	if getSSHCommand(m, "test -d "+vmProvisionDir).Run() == nil {
+		return nil
+	}
+	return uploadProvision(m, p.Provision)
+}
+
+// Record the --provision directory of `init` for the first `up`.
+func recordInitProvision() error {
+	p, err := loadVMProfile()
+	if err != nil {
+		return err
+	}
+	p.Provision = ""
+	if B2D.Provision != "" {
+		if p.Provision, err = filepath.Abs(B2D.Provision); err != nil {
+			return err
+		}
+	}
+	return p.save()
+}
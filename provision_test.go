@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRecordInitProvision(t *testing.T) {
+	saved := B2D
+	defer func() { B2D = saved }()
+	dir, err := ioutil.TempDir("", "b2d-provision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	B2D.Dir = dir
+	B2D.VM = "test-vm"
+
+	// Recorded as an absolute path, keeping the rest of the profile.
+	p, err := loadVMProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Daemon["debug"] = "true"
+	if err := p.save(); err != nil {
+		t.Fatal(err)
+	}
+	B2D.Provision = filepath.Join(dir, "provision")
+	if err := recordInitProvision(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = loadVMProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Provision != B2D.Provision || p.Daemon["debug"] != "true" {
+		t.Errorf("got Provision %q, Daemon %v", p.Provision, p.Daemon)
+	}
+
+	// A later init without --provision forgets it.
+	B2D.Provision = ""
+	if err := recordInitProvision(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = loadVMProfile(); err != nil || p.Provision != "" {
+		t.Errorf("got Provision %q (%v), want none", p.Provision, err)
+	}
+}
+
+func TestProvisionRunnerCerts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the runner is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "b2d-provision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The runner, with the VM paths moved under dir.
+	runner := strings.Replace(provisionRunner, "/var/lib/boot2docker", dir+"/disk", -1)
+	runner = strings.Replace(runner, "/etc/ssl/certs", dir+"/ssl", -1)
+	bundle := filepath.Join(dir, "ssl", "ca-certificates.crt")
+	for _, d := range []string{"disk/provision/certs", "ssl"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, _ := testKeyPair(t)
+	if err := ioutil.WriteFile(filepath.Join(dir, "disk/provision/certs/corp.crt"), cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func() string {
+		cmd := exec.Command("sh", "-s")
+		cmd.Stdin = strings.NewReader(runner)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %s", err, out)
+		}
+		return string(out)
+	}
+
+	for i, tt := range []struct {
+		bundle  string // bundle before the run
+		changed bool
+	}{
+		{"", true},            // new certificate
+		{string(cert), false}, // after a reboot, boot2docker loaded it from the disk
+		{"", false},           // already on the disk, whatever the bundle holds
+	} {
+		if err := ioutil.WriteFile(bundle, []byte(tt.bundle), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out := run()
+		if changed := strings.Contains(out, certsChangedMarker); changed != tt.changed {
+			t.Errorf("run %d: certificates changed: %v, want %v (output %q)", i, changed, tt.changed, out)
+		}
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "disk/certs/corp.pem")); err != nil || string(b) != string(cert) {
+		t.Errorf("certificate not installed on the disk: %v", err)
+	}
+}
+
+func TestWriteTarDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2d-tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "certs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "10-sysctl.sh"), []byte("sysctl -w vm.max_map_count=262144\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "certs", "corp.pem"), []byte("cert"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := writeTarDir(tw, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(tr)
+		got[hdr.Name] = string(b)
+		if hdr.Name == "10-sysctl.sh" && hdr.Mode&0100 == 0 {
+			t.Errorf("%s lost its executable bit: %o", hdr.Name, hdr.Mode)
+		}
+	}
+	want := map[string]string{
+		"./":             "",
+		"10-sysctl.sh":   "sysctl -w vm.max_map_count=262144\n",
+		"certs/":         "",
+		"certs/corp.pem": "cert",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Profile of the Docker daemon on the VM's persistent disk, sourced by its
+// init script.
+const daemonProfile = "/var/lib/boot2docker/profile"
+
+// Markers of the proxy block in daemonProfile.
+const (
+	proxyBlockBegin = "# BEGIN boot2docker proxy"
+	proxyBlockEnd   = "# END boot2docker proxy"
+)
+
+// Proxy settings for the Docker daemon: the --http-proxy, --https-proxy and
+// --no-proxy settings, or else the host's environment.
+func proxySettings() map[string]string {
+	env := func(name string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		return os.Getenv(strings.ToLower(name))
+	}
+	settings := map[string]string{}
+	for name, value := range map[string]string{
+		"HTTP_PROXY":  B2D.HTTPProxy,
+		"HTTPS_PROXY": B2D.HTTPSProxy,
+		"NO_PROXY":    B2D.NoProxy,
+	} {
+		if value == "" {
+			value = env(name)
+		}
+		if value != "" {
+			settings[name] = value
+		}
+	}
+	return settings
+}
+
+// Shell lines exporting the proxy settings, in a stable order.
+func proxyProfileLines(settings map[string]string) []string {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{}
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("export %s=%s", name, shellQuote(settings[name])))
+	}
+	return lines
+}
+
+// Whether the proxy URL points at the host's loopback interface, which the
+// VM cannot reach.
+func isLoopbackProxy(proxy string) bool {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return false
+	}
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Write the proxy settings into the daemon profile of the VM, and return
+// whether they changed (the daemon then needs a restart). Without proxy
+// settings, a block left by a previous `up` is removed.
+func propagateProxy(m driver.Machine) (bool, error) {
+	if B2D.NoProxyPropagation {
+		return false, nil
+	}
+	settings := proxySettings()
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY"} {
+		if isLoopbackProxy(settings[name]) {
+			fmt.Fprintf(os.Stderr, "Warning: %s=%s points at this host's loopback interface, which the VM cannot reach.\n", name, settings[name])
+		}
+	}
+	return setVMFileBlock(m, daemonProfile, "", proxyBlockBegin, proxyBlockEnd, proxyProfileLines(settings), 0644)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Readiness stages of a starting VM, in the order they are reached.
+const (
+	stageRunning = "running" // VM running according to the driver
+	stageSSH     = "ssh"     // SSH handshake on the NAT port forwarding
+	stageIP      = "ip"      // VM IP address on the host-only network
+	stageSocket  = "socket"  // Docker daemon running, its socket known
+	stageTCP     = "tcp"     // Docker socket accepting connections
+	stageTLS     = "tls"     // TLS handshake with the host copy of the certs
+	stagePing    = "ping"    // Docker remote API answering /_ping
+)
+
+var stageDescriptions = map[string]string{
+	stageRunning: "the VM to run",
+	stageSSH:     "SSH to the VM",
+	stageIP:      "the VM IP address",
+	stageSocket:  "the Docker daemon to start",
+	stageTCP:     "the Docker socket to accept connections",
+	stageTLS:     "the TLS handshake with the Docker daemon",
+	stagePing:    "the Docker daemon to answer /_ping",
+}
+
+// Conditions of `wait --for`.
+const (
+	waitForRunning = "running"
+	waitForSSH     = "ssh"
+	waitForDocker  = "docker"
+)
+
+// Longest wait between two attempts of a stage.
+const maxBackoff = 5 * time.Second
+
+// A stage that did not complete in time.
+type readinessError struct {
+	stage   string
+	timeout time.Duration
+	err     error
+}
+
+func (e readinessError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for %s: %s", e.timeout, stageDescriptions[e.stage], e.err)
+}
+
+// An error retrying cannot fix, e.g. a misconfiguration, which ends a wait
+// right away.
+type fatalError struct {
+	error
+}
+
+// Waits for the stages of a VM to complete, all within an overall timeout.
+// What the stages learn (IP address, socket) is kept for the next ones.
+type readiness struct {
+	ctx      context.Context
+	m        driver.Machine
+	timeout  time.Duration
+	deadline time.Time
+	progress bool // print a dot for each failed attempt
+
+	IP       string
+	Socket   string
+	CertPath string // host copy of the certs, empty for a daemon without TLS
+}
+
+func newReadiness(ctx context.Context, m driver.Machine, timeout time.Duration) *readiness {
+	return &readiness{ctx: ctx, m: m, timeout: timeout, deadline: time.Now().Add(timeout)}
+}
+
+// Wait for each of stages in turn, retrying with an exponential backoff
+// (starting at --waittime) until the deadline (none for a zero timeout) or
+// the cancellation of the context.
+func (r *readiness) wait(stages ...string) error {
+	for _, stage := range stages {
+		setProgress("waiting for %s", stageDescriptions[stage])
+		backoff := time.Duration(B2D.Waittime) * time.Millisecond
+		if backoff <= 0 {
+			backoff = 100 * time.Millisecond
+		}
+		for {
+			err := r.check(stage)
+			if err == nil {
+				break
+			}
+			if _, ok := err.(fatalError); ok {
+				return err
+			}
+			if B2D.Verbose {
+				fmt.Printf("Waiting for %s: %s\n", stageDescriptions[stage], err)
+			} else if r.progress {
+				print(".")
+			}
+			if r.timeout > 0 {
+				left := r.deadline.Sub(time.Now())
+				if left <= 0 {
+					return readinessError{stage, r.timeout, err}
+				}
+				if backoff > left {
+					backoff = left
+				}
+			}
+			select {
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+	return nil
+}
+
+// Context of an attempt, bound to the overall deadline (if any) so that a
+// hanging ssh does not overrun it.
+func (r *readiness) checkContext() (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(r.ctx)
+	}
+	return context.WithDeadline(r.ctx, r.deadline)
+}
+
+// Attempt stage once.
+func (r *readiness) check(stage string) error {
+	switch stage {
+	case stageRunning:
+		if err := r.m.Refresh(r.ctx); err != nil {
+			return err
+		}
+		if state := r.m.GetState(); state != driver.Running {
+			return fmt.Errorf("VM is %s", state)
+		}
+		return nil
+	case stageSSH:
+		if err := read(fmt.Sprintf("localhost:%d", r.m.GetSSHPort()), 1, 0); err != nil {
+			return err
+		}
+		ctx, cancel := r.checkContext()
+		defer cancel()
+		return getSSHCommandContext(ctx, r.m, "true").Run()
+	case stageIP:
+		ctx, cancel := r.checkContext()
+		defer cancel()
+		var err error
+		r.IP, err = RequestIP(ctx, r.m)
+		return err
+	case stageSocket:
+		ctx, cancel := r.checkContext()
+		defer cancel()
+		var err error
+		if r.Socket, err = RequestSocketFromSSH(ctx, r.m); err != nil && useSerial() {
+			if socket, serr := RequestSocketFromSerialPort(r.m); serr == nil {
+				r.Socket, err = socket, nil
+			}
+		}
+		return err
+	case stageTCP:
+		addr, err := r.socketAddr()
+		if err != nil {
+			return err
+		}
+		conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case stageTLS:
+		if r.CertPath == "" {
+			return nil
+		}
+		addr, err := r.socketAddr()
+		if err != nil {
+			return err
+		}
+		config, err := dockerTLSConfig(r.CertPath)
+		if err != nil {
+			return err
+		}
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 2 * time.Second}, "tcp", addr, config)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case stagePing:
+		if r.Socket == "" {
+			return fmt.Errorf("Docker socket unknown")
+		}
+		docker, err := newDockerClient(r.Socket, r.CertPath)
+		if err != nil {
+			return err
+		}
+		docker.client.Timeout = 5 * time.Second
+		body, err := docker.open("/_ping")
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if s := strings.TrimSpace(string(b)); s != "OK" {
+			return fmt.Errorf("unexpected answer %q", s)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown readiness stage %q", stage)
+}
+
+// Wait for the Docker daemon to be usable, getting the host copy of its
+// certificates on the way.
+func (r *readiness) waitDocker() error {
+	if err := r.wait(stageSocket); err != nil {
+		return err
+	}
+	certPath, err := RequestCertsUsingSSH(r.m)
+	if err != nil {
+		// These errors are not fatal
+		fmt.Fprintf(os.Stderr, "Warning: error copying certificates: %s\n", err)
+	}
+	r.CertPath = certPath
+	if certPath == "" && r.tlsSocket() {
+		// Plain HTTP to a TLS port would only fail until the timeout.
+		fmt.Fprintf(os.Stderr, "Warning: no certificates for the TLS Docker daemon at %s, not checking that it answers\n", r.Socket)
+		return r.wait(stageTCP)
+	}
+	if err := r.wait(stageTCP); err != nil {
+		return err
+	}
+	if B2D.DockerIPv6 {
+		if err := checkServerCertHost(r.Socket, r.CertPath); err != nil {
+			return err
+		}
+	}
+	return r.wait(stageTLS, stagePing)
+}
+
+// Whether the Docker socket is on the port of Docker over TLS.
+func (r *readiness) tlsSocket() bool {
+	_, port, err := splitDockerSocket(r.Socket)
+	return err == nil && port == strconv.Itoa(driver.DockerPort)
+}
+
+// Validate the --for condition of `wait`.
+func checkWaitFor(cond string) error {
+	switch cond {
+	case waitForRunning, waitForSSH, waitForDocker:
+		return nil
+	}
+	return fmt.Errorf("invalid wait condition %q (expected running, ssh or docker)", cond)
+}
+
+func (r *readiness) socketAddr() (string, error) {
+	if r.Socket == "" {
+		return "", fmt.Errorf("Docker socket unknown")
+	}
+	host, port, err := splitDockerSocket(r.Socket)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+func TestReadiness(t *testing.T) {
+	saved := B2D
+	defer func() { B2D = saved }()
+	B2D.Waittime = 10
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			fmt.Fprint(w, "OK")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	r := newReadiness(context.Background(), nil, 5*time.Second)
+	r.Socket = "tcp://" + strings.TrimPrefix(srv.URL, "http://")
+	if err := r.wait(stageTCP, stageTLS, stagePing); err != nil {
+		t.Fatal(err)
+	}
+
+	// A closed port times out in the TCP stage, which the error names.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	r = newReadiness(context.Background(), nil, 200*time.Millisecond)
+	r.Socket = "tcp://" + addr
+	start := time.Now()
+	err = r.wait(stageTCP, stagePing)
+	if e, ok := err.(readinessError); !ok || e.stage != stageTCP {
+		t.Errorf("got %v, want a timeout in the tcp stage", err)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("wait overran its timeout: took %s", d)
+	}
+
+	// A cancelled context ends the wait before its deadline.
+	ctx, cancel := context.WithCancel(context.Background())
+	r = newReadiness(ctx, nil, time.Minute)
+	r.Socket = "tcp://" + addr
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start = time.Now()
+	if err := r.wait(stageTCP); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("wait ignored the cancellation: took %s", d)
+	}
+}
+
+func TestReadinessNoTimeout(t *testing.T) {
+	saved := B2D
+	defer func() { B2D = saved }()
+	B2D.Waittime = 10
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	// A zero timeout keeps retrying until cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	r := newReadiness(ctx, nil, 0)
+	r.Socket = "tcp://" + addr
+	if err := r.wait(stageTCP); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTLSSocket(t *testing.T) {
+	for socket, want := range map[string]bool{
+		"tcp://192.168.59.103:2376":   true,
+		"tcp://[fd00:b2d::103]:2376":  true,
+		"tcp://192.168.59.103:2375":   false,
+		"unix:///var/run/docker.sock": false,
+		"":                            false,
+	} {
+		r := &readiness{Socket: socket}
+		if got := r.tlsSocket(); got != want {
+			t.Errorf("tlsSocket(%q) = %v, want %v", socket, got, want)
+		}
+	}
+}
+
+func TestCheckWaitFor(t *testing.T) {
+	for _, cond := range []string{"running", "ssh", "docker"} {
+		if err := checkWaitFor(cond); err != nil {
+			t.Errorf("checkWaitFor(%q): %s", cond, err)
+		}
+	}
+	for _, cond := range []string{"", "up", "Docker"} {
+		if err := checkWaitFor(cond); err == nil {
+			t.Errorf("checkWaitFor(%q): expected an error", cond)
+		}
+	}
+}
+
+func TestReadinessSSHDeadline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh is a shell script")
+	}
+	saved := B2D
+	defer func() { B2D = saved }()
+	dir, err := ioutil.TempDir("", "b2d-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	B2D.SSH = filepath.Join(dir, "ssh")
+	if err := ioutil.WriteFile(B2D.SSH, []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	B2D.Driver = "dummy"
+	m, err := driver.GetMachine(context.Background(), &B2D)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An ssh that hangs is killed at the deadline.
+	r := newReadiness(context.Background(), m, 300*time.Millisecond)
+	start := time.Now()
+	err = r.wait(stageSocket)
+	if e, ok := err.(readinessError); !ok || e.stage != stageSocket {
+		t.Errorf("got %v, want a timeout in the socket stage", err)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("wait overran its timeout: took %s", d)
+	}
+}
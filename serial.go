@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Credentials of the boot2docker user, for the serial console getty.
+const (
+	serialUser     = "docker"
+	serialPassword = "tcuser"
+)
+
+// How long each step of a serial session may take.
+const serialStepTimeout = 5 * time.Second
+
+var (
+	reSerialLogin    = regexp.MustCompile(`login: *$`)
+	reSerialPassword = regexp.MustCompile(`[Pp]assword: *$`)
+	reSerialPrompt   = regexp.MustCompile(`[$#] *$`)
+	// The markers are split in the command line, so that its echo does not
+	// match.
+	reSerialBegin = regexp.MustCompile(`__B2D_BEGIN__\r?\n`)
+	reSerialEnd   = regexp.MustCompile(`__B2D_END__ (\d+)\r?\n`)
+)
+
+// Connect to the serial port of the VM: a unix socket, or a named pipe on
+// Windows. VirtualBox accepts a single client at a time.
+func dialSerial(path string) (io.ReadWriteCloser, error) {
+	if runtime.GOOS == "windows" {
+		return os.OpenFile(path, os.O_RDWR, 0)
+	}
+	return net.Dial("unix", path)
+}
+
+// Expect-style session on the serial console of the VM.
+type serialSession struct {
+	conn   io.ReadWriteCloser
+	chunks chan []byte // output of the VM, closed when the connection is
+	buf    []byte      // output received but not consumed by expect yet
+	log    bytes.Buffer
+	wg     sync.WaitGroup
+}
+
+func newSerialSession(conn io.ReadWriteCloser) *serialSession {
+	s := &serialSession{conn: conn, chunks: make(chan []byte, 16)}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(s.chunks)
+		for {
+			b := make([]byte, 1024)
+			n, err := conn.Read(b)
+			if n > 0 {
+				s.chunks <- b[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Open a session on the serial console at path and log in.
+func openSerialSession(path string) (*serialSession, error) {
+	conn, err := dialSerial(path)
+	if err != nil {
+		return nil, err
+	}
+	s := newSerialSession(conn)
+	if err := s.login(); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Wait up to timeout for the output to match re, consuming it up to the end
+// of the match, and return the submatches.
+func (s *serialSession) expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	deadline := time.After(timeout)
+	for {
+		if loc := re.FindSubmatchIndex(s.buf); loc != nil {
+			m := make([]string, len(loc)/2)
+			for i := range m {
+				if loc[2*i] >= 0 {
+					m[i] = string(s.buf[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			s.buf = s.buf[loc[1]:]
+			return m, nil
+		}
+		select {
+		case b, ok := <-s.chunks:
+			if !ok {
+				return nil, fmt.Errorf("serial console closed")
+			}
+			s.buf = append(s.buf, b...)
+			s.log.Write(b)
+		case <-deadline:
+			return nil, fmt.Errorf("timed out waiting for %q on the serial console", re)
+		}
+	}
+}
+
+// Type line on the console.
+func (s *serialSession) send(line string) error {
+	s.buf = nil
+	_, err := s.conn.Write([]byte(line + "\r"))
+	return err
+}
+
+// Get to a shell prompt, logging in if the getty asks for it.
+func (s *serialSession) login() error {
+	prompts := regexp.MustCompile(reSerialLogin.String() + "|" + reSerialPassword.String() + "|" + reSerialPrompt.String())
+	if err := s.send(""); err != nil {
+		return err
+	}
+	for step := 0; step < 3; step++ {
+		m, err := s.expect(prompts, serialStepTimeout)
+		if err != nil {
+			return err
+		}
+		switch {
+		case reSerialLogin.MatchString(m[0]):
+			err = s.send(serialUser)
+		case reSerialPassword.MatchString(m[0]):
+			err = s.send(serialPassword)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to log in on the serial console")
+}
+
+// Run command in the shell of the session and return its output.
+func (s *serialSession) run(command string, timeout time.Duration) (string, error) {
+	if err := s.send(`echo __B2D_""BEGIN__; ` + command + `; echo __B2D_""END__ $?`); err != nil {
+		return "", err
+	}
+	if _, err := s.expect(reSerialBegin, timeout); err != nil {
+		return "", err
+	}
+	start := s.log.Len() - len(s.buf)
+	m, err := s.expect(reSerialEnd, timeout)
+	if err != nil {
+		return "", err
+	}
+	end := s.log.Len() - len(s.buf) - len(m[0])
+	out := strings.Replace(string(s.log.Bytes()[start:end]), "\r\n", "\n", -1)
+	if status, _ := strconv.Atoi(m[1]); status != 0 {
+		return out, fmt.Errorf("%q exited with status %d", command, status)
+	}
+	return out, nil
+}
+
+// End the session, waiting for the reader to finish.
+func (s *serialSession) close() error {
+	err := s.conn.Close()
+	for range s.chunks {
+	}
+	s.wg.Wait()
+	return err
+}
+
+// Run command over the serial console of m, e.g. when SSH is not available.
+func serialQuery(m driver.Machine, command string) (string, error) {
+	s, err := openSerialSession(m.GetSerialFile())
+	if err != nil {
+		return "", err
+	}
+	defer s.close()
+	out, err := s.run(command, serialStepTimeout)
+	if err != nil && B2D.Verbose {
+		fmt.Printf("Serial console output:\n%s\nEND serial console output\n", s.log.String())
+	}
+	return out, err
+}
+
+// RequestIPFromSerialPort returns the IP address of the VM network interface,
+// asking over the serial console.
+func RequestIPFromSerialPort(m driver.Machine) (string, error) {
+	out, err := serialQuery(m, "ip addr show")
+	if err != nil {
+		return "", err
+	}
+	return vmInterfaceIP(out, vmNICMac(m))
+}
+
+// Same as RequestSocketFromSSH, over the serial console.
+func RequestSocketFromSerialPort(m driver.Machine) (string, error) {
+	out, err := serialQuery(m, "grep tcp:// /proc/$(cat /var/run/docker.pid)/cmdline")
+	if err != nil {
+		return "", err
+	}
+	return dockerSocket(out, false, func() (string, error) {
+		return RequestIPFromSerialPort(m)
+	})
+}
+
+// Status of the Docker daemon as reported by its init script, over the serial
+// console.
+func RequestDockerStatusFromSerialPort(m driver.Machine) (string, error) {
+	return serialQuery(m, "/etc/init.d/docker status")
+}
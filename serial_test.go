@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Play the serial console of a VM on conn: a getty asking for the docker
+// user, then a shell running the commands of outputs.
+func fakeSerialConsole(conn net.Conn, outputs map[string]string) {
+	defer conn.Close()
+	reWrapped := regexp.MustCompile(`^echo __B2D_""BEGIN__; (.*); echo __B2D_""END__ \$\?$`)
+	r := bufio.NewReader(conn)
+	loggedIn := false
+	for {
+		line, err := r.ReadString('\r')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSuffix(line, "\r")
+		fmt.Fprintf(conn, "%s\r\n", line) // echo
+		switch {
+		case !loggedIn && line == "docker":
+			loggedIn = true
+		case !loggedIn:
+			fmt.Fprint(conn, "\r\nboot2docker login: ")
+			continue
+		case reWrapped.MatchString(line):
+			command := reWrapped.FindStringSubmatch(line)[1]
+			out, ok := outputs[command]
+			status := 0
+			if !ok {
+				out, status = "sh: "+command+": not found\n", 127
+			}
+			fmt.Fprintf(conn, "__B2D_BEGIN__\r\n%s__B2D_END__ %d\r\n", strings.Replace(out, "\n", "\r\n", -1), status)
+		}
+		fmt.Fprint(conn, "docker@boot2docker:~$ ")
+	}
+}
+
+func TestSerialSession(t *testing.T) {
+	client, vm := net.Pipe()
+	go fakeSerialConsole(vm, map[string]string{"ip addr show": testIPAddrShow})
+
+	s := newSerialSession(client)
+	if err := s.login(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.run("ip addr show", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip, err := vmInterfaceIP(out, ""); err != nil || ip != "192.168.59.103" {
+		t.Errorf("got %q (%v), want 192.168.59.103", ip, err)
+	}
+	if _, err := s.run("bogus", time.Second); err == nil || !strings.Contains(err.Error(), "status 127") {
+		t.Errorf("got %v, want an exit status error", err)
+	}
+
+	// A silent console times out instead of hanging.
+	if _, err := s.expect(regexp.MustCompile("never"), 50*time.Millisecond); err == nil {
+		t.Error("expected a timeout")
+	}
+	done := make(chan struct{})
+	go func() {
+		s.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("close did not return")
+	}
+}
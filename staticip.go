@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Boot script on the persistent disk run before the Docker daemon starts, so
+// that its TLS certificate is generated for the static IP.
+const bootsyncScript = "/var/lib/boot2docker/bootsync.sh"
+
+// Markers of the static IP block in bootsyncScript.
+const (
+	staticIPBlockBegin = "# BEGIN boot2docker static IP"
+	staticIPBlockEnd   = "# END boot2docker static IP"
+)
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+// Check that the static VM IP lies on the host-only network given by hostIP
+// and mask, and that it cannot be handed out by its DHCP server.
+func checkVMIP(ip, hostIP net.IP, mask net.IPMask, dhcpIP, lowerIP, upperIP net.IP) error {
+	if ip.To4() == nil {
+		return fmt.Errorf("VM IP %s is not an IPv4 address", ip)
+	}
+	subnet := net.IPNet{IP: hostIP.Mask(mask), Mask: mask}
+	if !subnet.Contains(ip) {
+		return fmt.Errorf("VM IP %s is not on the host-only network %s", ip, subnet.String())
+	}
+	broadcast := ipToUint32(subnet.IP) | ^binary.BigEndian.Uint32(net.IP(mask).To4())
+	if n := ipToUint32(ip); n == ipToUint32(subnet.IP) || n == broadcast {
+		return fmt.Errorf("VM IP %s is the network or broadcast address of %s", ip, subnet.String())
+	}
+	switch {
+	case ip.Equal(hostIP):
+		return fmt.Errorf("VM IP %s is the host IP", ip)
+	case ip.Equal(dhcpIP):
+		return fmt.Errorf("VM IP %s is the DHCP server IP", ip)
+	}
+	if n := ipToUint32(ip); n >= ipToUint32(lowerIP) && n <= ipToUint32(upperIP) {
+		return fmt.Errorf("VM IP %s is inside the DHCP range %s-%s", ip, lowerIP, upperIP)
+	}
+	return nil
+}
+
+// Check the --vm-ip setting against the VM network settings.
+func checkStaticVMIP() error {
+	if B2D.VMIP == nil {
+		return nil
+	}
+	if B2D.Network != "" && B2D.Network != string(driver.NICNetHostonly) {
+		return fmt.Errorf("a static VM IP requires the host-only network")
+	}
+	return checkVMIP(B2D.VMIP, B2D.HostIP, B2D.NetMask, B2D.DHCPIP, B2D.LowerIP, B2D.UpperIP)
+}
+
+// Shell commands giving the interface with the given MAC address (e.g.
+// "0800270C5B7A") the static IP, in place of its DHCP lease.
+func staticIPLines(ip net.IP, mask net.IPMask, mac string) []string {
+	ones, _ := mask.Size()
+	lines := []string{"iface=eth1"}
+	if mac = strings.ToLower(strings.Replace(mac, ":", "", -1)); len(mac) == 12 {
+		pairs := []string{}
+		for i := 0; i < len(mac); i += 2 {
+			pairs = append(pairs, mac[i:i+2])
+		}
+		lines = []string{
+			fmt.Sprintf("iface=$(ip -o link | grep -i 'link/ether %s' | cut -d: -f2 | tr -d ' ')", strings.Join(pairs, ":")),
+			"[ -n \"$iface\" ] || iface=eth1",
+		}
+	}
+	return append(lines,
+		"pkill -f \"udhcpc.*-i $iface\"",
+		"ip addr flush dev $iface",
+		fmt.Sprintf("ip addr add %s/%d brd + dev $iface", ip, ones),
+	)
+}
+
+// Make the VM keep B2D.VMIP across reboots, and switch to it right away.
+// Without a static IP, a block left by a previous setting is removed (the
+// DHCP lease comes back on the next boot). Returns the static IP, if any.
+func applyStaticIP(ctx context.Context, m driver.Machine) (string, error) {
+	var lines []string
+	if B2D.VMIP != nil {
+		if err := checkStaticVMIP(); err != nil {
+			return "", err
+		}
+		mac := ""
+		for _, nic := range m.GetInfo().NICs {
+			if nic.Slot == vmNIC {
+				mac = nic.MacAddr
+			}
+		}
+		lines = staticIPLines(B2D.VMIP, B2D.NetMask, mac)
+	}
+
+	changed, err := setVMFileBlock(m, bootsyncScript, "#!/bin/sh\n", staticIPBlockBegin, staticIPBlockEnd, lines, 0755)
+	if err != nil {
+		return "", err
+	}
+	if B2D.VMIP == nil {
+		if changed {
+			fmt.Fprintf(os.Stderr, "Static VM IP removed, the VM gets its IP from DHCP again after a restart.\n")
+		}
+		return "", nil
+	}
+
+	current, err := RequestIPFromSSH(ctx, m)
+	if err == nil && current == B2D.VMIP.String() {
+		return current, nil
+	}
+	cmd := getSSHCommand(m, "sudo sh -s")
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	// SSH goes through the NAT interface, so switching the address does not
+	// drop the session.
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to set the VM IP: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "VM IP set to %s; restart the VM (`boot2docker restart`) if the Docker TLS certificate was issued for another IP.\n", B2D.VMIP)
+	return B2D.VMIP.String(), nil
+}
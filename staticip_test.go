@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCheckVMIP(t *testing.T) {
+	hostIP := net.ParseIP("192.168.59.3")
+	mask := net.CIDRMask(24, 32)
+	dhcpIP := net.ParseIP("192.168.59.99")
+	lower, upper := net.ParseIP("192.168.59.103"), net.ParseIP("192.168.59.254")
+
+	for _, tt := range []struct {
+		ip string
+		ok bool
+	}{
+		{"192.168.59.50", true},
+		{"192.168.59.102", true},
+		{"192.168.59.103", false}, // DHCP range
+		{"192.168.59.200", false},
+		{"192.168.59.254", false},
+		{"192.168.59.3", false},  // host
+		{"192.168.59.99", false}, // DHCP server
+		{"192.168.59.0", false},
+		{"192.168.59.255", false},
+		{"192.168.60.50", false},
+		{"fd00:b2d::50", false},
+	} {
+		err := checkVMIP(net.ParseIP(tt.ip), hostIP, mask, dhcpIP, lower, upper)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%s: got %v, want ok = %v", tt.ip, err, tt.ok)
+		}
+	}
+}
+
+func TestStaticIPLines(t *testing.T) {
+	lines := staticIPLines(net.ParseIP("192.168.59.50"), net.CIDRMask(24, 32), "0800270C5B7A")
+	script := strings.Join(lines, "\n")
+	for _, want := range []string{"link/ether 08:00:27:0c:5b:7a", "ip addr add 192.168.59.50/24 brd + dev $iface"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script does not contain %q:\n%s", want, script)
+		}
+	}
+
+	lines = staticIPLines(net.ParseIP("192.168.59.50"), net.CIDRMask(24, 32), "")
+	if lines[0] != "iface=eth1" {
+		t.Errorf("without a MAC address, got %q, want iface=eth1", lines[0])
+	}
+}
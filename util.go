@@ -2,9 +2,11 @@ package main
 
 import (
 	"archive/tar"
-	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,6 +17,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 
@@ -193,18 +196,13 @@ func CopyFile(src, dst string) (int64, error) {
 	return io.Copy(df, sf)
 }
 
-func reader(r io.Reader) {
-	buf := make([]byte, 1024)
-	for {
-		_, err := io.ReadAtLeast(r, buf[:], 20)
-		if err != nil {
-			return
-		}
-	}
-}
-
 func getSSHCommand(m driver.Machine, args ...string) *exec.Cmd {
+	return getSSHCommandContext(context.Background(), m, args...)
+}
 
+// SSH command killed once ctx is done. With a deadline, ssh gives up
+// connecting by then too.
+func getSSHCommandContext(ctx context.Context, m driver.Machine, args ...string) *exec.Cmd {
 	DefaultSSHArgs := []string{
 		"-o", "IdentitiesOnly=yes",
 		"-o", "StrictHostKeyChecking=no",
@@ -215,8 +213,13 @@ func getSSHCommand(m driver.Machine, args ...string) *exec.Cmd {
 		"docker@localhost",
 	}
 
+	if deadline, ok := ctx.Deadline(); ok {
+		secs := int(deadline.Sub(time.Now())/time.Second) + 1
+		DefaultSSHArgs = append([]string{"-o", fmt.Sprintf("ConnectTimeout=%d", secs)}, DefaultSSHArgs...)
+	}
+
 	sshArgs := append(DefaultSSHArgs, args...)
-	cmd := exec.Command(B2D.SSH, sshArgs...)
+	cmd := exec.CommandContext(ctx, B2D.SSH, sshArgs...)
 	if B2D.Verbose {
 		cmd.Stderr = os.Stderr
 		log.Printf("executing: %v %v", cmd.Path, strings.Join(cmd.Args, " "))
@@ -225,31 +228,144 @@ func getSSHCommand(m driver.Machine, args ...string) *exec.Cmd {
 	return cmd
 }
 
-func RequestIPFromSSH(m driver.Machine) (string, error) {
-	cmd := getSSHCommand(m, "ip addr show dev eth1")
+// The VM network (host-only or bridged) is on the second NIC.
+const vmNIC = 2
 
-	b, err := cmd.Output()
+// RequestIP returns the IP address of the VM network interface: from the
+// driver when it can tell (e.g. VirtualBox guest properties), else over the
+// serial console (with --serial) or SSH.
+func RequestIP(ctx context.Context, m driver.Machine) (string, error) {
+	// What failed, reported as a whole if no method works.
+	var failed []string
+	IP, err := m.GetIP(ctx)
+	if err == nil {
+		return IP, nil
+	}
+	if err != driver.ErrNotSupported {
+		failed = append(failed, fmt.Sprintf("from the driver: %s", err))
+	}
+	if useSerial() {
+		if IP, err = RequestIPFromSerialPort(m); err == nil {
+			return IP, nil
+		}
+		failed = append(failed, fmt.Sprintf("via serial: %s", err))
+	}
+	if IP, err = RequestIPFromSSH(ctx, m); err == nil {
+		return IP, nil
+	}
+	failed = append(failed, fmt.Sprintf("via SSH: %s", err))
+	return "", errors.New(strings.Join(failed, "; "))
+}
+
+func RequestIPFromSSH(ctx context.Context, m driver.Machine) (string, error) {
+	out, mac, err := requestIPAddrFromSSH(ctx, m)
 	if err != nil {
 		return "", err
 	}
+	return vmInterfaceIP(out, mac)
+}
+
+// RequestIPv6FromSSH returns the global IPv6 address of the VM network
+// interface.
+func RequestIPv6FromSSH(ctx context.Context, m driver.Machine) (string, error) {
+	out, mac, err := requestIPAddrFromSSH(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	return vmInterfaceIPv6(out, mac)
+}
+
+// Run `ip addr show` in the VM, and return its output along with the MAC
+// address of the VM network NIC.
+func requestIPAddrFromSSH(ctx context.Context, m driver.Machine) (string, string, error) {
+	cmd := getSSHCommandContext(ctx, m, "ip addr show")
+
+	b, err := cmd.Output()
+	if err != nil {
+		return "", "", err
+	}
 	out := string(b)
 	if B2D.Verbose {
 		fmt.Printf("SSH returned: %s\nEND SSH\n", out)
 	}
-	// parse to find: inet 192.168.59.103/24 brd 192.168.59.255 scope global eth1
-	lines := strings.Split(out, "\n")
-	for _, line := range lines {
-		vals := strings.Split(strings.TrimSpace(line), " ")
-		if len(vals) >= 2 && vals[0] == "inet" {
-			return vals[1][:strings.Index(vals[1], "/")], nil
+	return out, vmNICMac(m), nil
+}
+
+// MAC address of the VM network NIC, as reported by the driver.
+func vmNICMac(m driver.Machine) string {
+	for _, nic := range m.GetInfo().NICs {
+		if nic.Slot == vmNIC {
+			return nic.MacAddr
 		}
 	}
+	return ""
+}
+
+var (
+	// 3: eth1: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc pfifo_fast state UP qlen 1000
+	reIPAddrIface = regexp.MustCompile(`^\d+: ([^:@ ]+)(?:@[^:]+)?: <`)
+	//     link/ether 08:00:27:0c:5b:7a brd ff:ff:ff:ff:ff:ff
+	reIPAddrEther = regexp.MustCompile(`^\s+link/ether ([0-9a-f:]+)`)
+	//     inet 192.168.59.103/24 brd 192.168.59.255 scope global eth1
+	reIPAddrInet = regexp.MustCompile(`^\s+inet ([0-9.]+)/`)
+	//     inet6 fd00:b2d::a00:27ff:fe0c:5b7a/64 scope global dynamic
+	// Link-local addresses ("scope link") are not usable without a zone.
+	reIPAddrInet6 = regexp.MustCompile(`^\s+inet6 ([0-9a-f:]+)/\d+ scope global`)
+)
 
+// Find the IPv4 address of the VM network interface in the output of
+// `ip addr show`. The interface is identified by the MAC address of the VM's
+// NIC as reported by the driver (e.g. "0800270C5B7A"); without one, eth1 is
+// assumed.
+func vmInterfaceIP(out, mac string) (string, error) {
+	if ip := vmInterfaceAddr(out, mac, reIPAddrInet); ip != "" {
+		return ip, nil
+	}
 	return "", fmt.Errorf("No IP address found %s", out)
 }
 
-func RequestSocketFromSSH(m driver.Machine) (string, error) {
-	cmd := getSSHCommand(m, "grep tcp:// /proc/$(cat /var/run/docker.pid)/cmdline")
+// Same as vmInterfaceIP, for the global IPv6 address.
+func vmInterfaceIPv6(out, mac string) (string, error) {
+	if ip := vmInterfaceAddr(out, mac, reIPAddrInet6); ip != "" {
+		return ip, nil
+	}
+	return "", fmt.Errorf("No global IPv6 address found %s", out)
+}
+
+func vmInterfaceAddr(out, mac string, re *regexp.Regexp) string {
+	mac = strings.ToLower(strings.Replace(mac, ":", "", -1))
+	iface, ether := "", ""
+	for _, line := range strings.Split(out, "\n") {
+		if m := reIPAddrIface.FindStringSubmatch(line); m != nil {
+			iface, ether = m[1], ""
+			continue
+		}
+		if m := reIPAddrEther.FindStringSubmatch(line); m != nil {
+			ether = strings.Replace(m[1], ":", "", -1)
+			continue
+		}
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if (mac != "" && ether == mac) || (mac == "" && iface == "eth1") {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// IP address of the VM to reach the Docker daemon at: the IPv4 one, or with
+// --docker-ipv6 the global IPv6 one.
+func requestDockerIP(ctx context.Context, m driver.Machine) (string, error) {
+	if B2D.DockerIPv6 {
+		return RequestIPv6FromSSH(ctx, m)
+	}
+	return RequestIP(ctx, m)
+}
+
+func RequestSocketFromSSH(ctx context.Context, m driver.Machine) (string, error) {
+	cmd := getSSHCommandContext(ctx, m, "grep tcp:// /proc/$(cat /var/run/docker.pid)/cmdline")
 
 	b, err := cmd.Output()
 	if err != nil {
@@ -259,15 +375,29 @@ func RequestSocketFromSSH(m driver.Machine) (string, error) {
 	if B2D.Verbose {
 		fmt.Printf("SSH returned: %s\nEND SSH\n", out)
 	}
+	return dockerSocket(out, B2D.DockerIPv6, func() (string, error) {
+		return requestDockerIP(ctx, m)
+	})
+}
+
+var reDockerListenAll = regexp.MustCompile(`^tcp://(0\.0\.0\.0|\[::\]):([0-9]+)`)
+
+// Docker socket from the tcp:// addresses the daemon listens on (one per
+// line), using ip() for the VM address when it listens on all of them. With
+// ipv6 (--docker-ipv6), the daemon must listen on all IPv6 addresses.
+func dockerSocket(out string, ipv6 bool, ip func() (string, error)) (string, error) {
 	// Lets only use the first one - its possible to specify more than one...
 	lines := strings.Split(out, "\n")
-	tcpRE := regexp.MustCompile(`^(tcp://)(0.0.0.0)(:.*)`)
-	if s := tcpRE.FindStringSubmatch(lines[0]); s != nil {
-		IP, err := RequestIPFromSSH(m)
+	s := reDockerListenAll.FindStringSubmatch(lines[0])
+	if ipv6 && (s == nil || s[1] != "[::]") {
+		return "", fatalError{fmt.Errorf("--docker-ipv6 needs the Docker daemon to listen on tcp://[::], not %s (e.g. boot2docker daemon config set DOCKER_HOST '-H tcp://[::]:%d')", strings.TrimSpace(lines[0]), driver.DockerPort)}
+	}
+	if s != nil {
+		IP, err := ip()
 		if err != nil {
 			return "", err
 		}
-		return s[1] + IP + s[3], nil
+		return "tcp://" + net.JoinHostPort(IP, s[2]), nil
 	}
 	if !strings.HasPrefix(lines[0], "tcp://") {
 		return "", fmt.Errorf("Error requesting Docker Socket: %s", lines[0])
@@ -275,62 +405,23 @@ func RequestSocketFromSSH(m driver.Machine) (string, error) {
 	return lines[0], nil
 }
 
-// use the serial port socket to ask what the VM's host only IP is
-func RequestIPFromSerialPort(socket string) (string, error) {
-	c, err := net.Dial("unix", socket)
-
-	if err != nil {
-		return "", err
+// Split a tcp://host:port Docker socket into its host and port. An IPv6 host
+// may or may not be bracketed.
+func splitDockerSocket(socket string) (host, port string, err error) {
+	if !strings.HasPrefix(socket, "tcp://") {
+		return "", "", fmt.Errorf("unsupported Docker socket %q", socket)
 	}
-	defer c.Close()
-	c.SetDeadline(time.Now().Add(time.Second))
-
-	line := ""
-	_, err = c.Write([]byte("\r"))
-	_, err = c.Write([]byte("docker\r"))
-
-	IP := ""
-	fullLog := ""
-
-	for IP == "" {
-		_, err := c.Write([]byte("ip addr show dev eth1\r"))
-		if err != nil {
-			return "", err
-		}
-		time.Sleep(1 * time.Second)
-		buf := make([]byte, 1024)
-		for {
-			n, err := c.Read(buf[:])
-			if err != nil {
-				return "", err
-			}
-			line = line + string(buf[0:n])
-			fullLog += string(buf[0:n])
-			if strings.Contains(line, "\n") {
-				//go looking for the string we want, and chomp line to after the \n
-				if i := strings.IndexAny(line, "\n"); i != -1 {
-					//     inet 10.180.1.3/16 brd 10.180.255.255 scope global wlan0
-					inetRE := regexp.MustCompile(`^[\t ]*inet ([0-9.]*).*$`)
-					if ip := inetRE.FindStringSubmatch(line[:i]); ip != nil {
-						IP = ip[1]
-						// clean up
-						break
-					} else {
-						line = line[i+1:]
-					}
-				}
-			}
-		}
-
+	addr := strings.TrimPrefix(socket, "tcp://")
+	if i := strings.Index(addr, "/"); i >= 0 {
+		addr = addr[:i]
 	}
-	go reader(c)
-	//give us time reader clean up
-	time.Sleep(1 * time.Second)
-	if IP == "" && B2D.Verbose {
-		fmt.Printf(fullLog)
+	if host, port, err = net.SplitHostPort(addr); err == nil {
+		return host, port, nil
 	}
-
-	return IP, nil
+	if i := strings.LastIndex(addr, ":"); i >= 0 && net.ParseIP(addr[:i]) != nil {
+		return addr[:i], addr[i+1:], nil
+	}
+	return "", "", fmt.Errorf("invalid Docker socket %q", socket)
 }
 
 // TODO: need to add or abstract to get a Serial coms version
@@ -342,47 +433,177 @@ func RequestIPFromSerialPort(socket string) (string, error) {
 func RequestCertsUsingSSH(m driver.Machine) (string, error) {
 	cmd := getSSHCommand(m, "tar c /home/docker/.docker/*.pem")
 
-	certDir := ""
-
 	b, err := cmd.Output()
-	if err == nil {
-		dir, err := cfgDir(".boot2docker")
+	if err != nil {
+		return "", nil
+	}
+	dir, err := cfgDir(".boot2docker")
+	if err != nil {
+		return "", err
+	}
+	files, err := readCertsTar(bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	certDir := filepath.Join(dir, "certs", m.GetName())
+	if err := writeCertDir(certDir, files); err != nil {
+		return "", err
+	}
+	return certDir, nil
+}
+
+// Read the files of a tar of certificates, by base name.
+func readCertsTar(r io.Reader) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return "", err
+			return nil, fmt.Errorf("Failed to read the certificates: %s", err)
 		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the certificates: %s", err)
+		}
+		files[filepath.Base(hdr.Name)] = b
+	}
+	return files, nil
+}
 
-		certDir = filepath.Join(dir, "certs", m.GetName())
+// Mode of the certificate file name: private keys are only readable by the
+// user.
+func certFileMode(name string) os.FileMode {
+	if strings.HasPrefix(name, "key") {
+		return 0600
+	}
+	return 0644
+}
 
-		// Open the tar archive for reading.
-		r := bytes.NewReader(b)
-		tr := tar.NewReader(r)
+// Replace the certificates in certDir with files, unless they are the same.
+// The files are written to a new directory next to certDir first, checked,
+// and swapped in as a whole, so that certDir never holds a partial or
+// mismatched set: certDir is a symlink to that directory, replaced with a
+// single rename. Where symlinks can't be created (Windows without the
+// privilege), the directories are swapped with two renames instead.
+func writeCertDir(certDir string, files map[string][]byte) error {
+	if len(files) == 0 {
+		return fmt.Errorf("no certificates found")
+	}
+	if cert, ok := files["cert.pem"]; ok {
+		if _, err := tls.X509KeyPair(cert, files["key.pem"]); err != nil {
+			return fmt.Errorf("Invalid client certificate: %s", err)
+		}
+	}
+	if sameCertDir(certDir, files) {
+		return nil
+	}
 
-		// Iterate through the files in the archive.
-		for {
-			hdr, err := tr.Next()
-			if err == io.EOF {
-				// end of tar archive
-				break
-			}
-			if err != nil {
-				return "", err
-			}
-			filename := filepath.Base(hdr.Name)
-			if err := os.MkdirAll(certDir, 0755); err != nil {
-				return "", err
-			}
-			certFile := filepath.Join(certDir, filename)
-			fmt.Fprintf(os.Stderr, "Writing %s\n", certFile)
-			f, err := os.Create(certFile)
-			if err != nil {
-				return "", err
-			}
-			w := bufio.NewWriter(f)
-			if _, err := io.Copy(w, tr); err != nil {
-				return "", err
+	parent := filepath.Dir(certDir)
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return err
+	}
+	prefix := "." + filepath.Base(certDir) + "-"
+	tmp, err := ioutil.TempDir(parent, prefix)
+	if err != nil {
+		return err
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			os.RemoveAll(tmp)
+		}
+	}()
+	for name, b := range files {
+		if err := writeFileSync(filepath.Join(tmp, name), b, certFileMode(name)); err != nil {
+			return fmt.Errorf("Failed to write the certificates: %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "Writing %s\n", filepath.Join(certDir, name))
+	}
+
+	// The directory the current symlink points to, removed once replaced.
+	var prev string
+	if target, err := os.Readlink(certDir); err == nil && strings.HasPrefix(target, prefix) && filepath.Base(target) == target {
+		prev = filepath.Join(parent, target)
+	}
+	next := tmp
+	link := tmp + ".link"
+	if err := os.Symlink(filepath.Base(tmp), link); err == nil {
+		defer os.Remove(link)
+		if err := os.Rename(link, certDir); err == nil {
+			swapped = true
+			if prev != "" {
+				os.RemoveAll(prev)
 			}
-			w.Flush()
+			return nil
 		}
+		// certDir is still a plain directory, written by an older version.
+		next = link
 	}
-	return certDir, nil
+
+	// A directory can't be renamed over a non-empty one, so move the old one
+	// aside first and put it back if the swap fails.
+	old := tmp + ".old"
+	if err := os.Rename(certDir, old); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to replace %s: %s", certDir, err)
+	}
+	if err := os.Rename(next, certDir); err != nil {
+		if rerr := os.Rename(old, certDir); rerr != nil && !os.IsNotExist(rerr) {
+			return fmt.Errorf("Failed to replace %s: %s; the previous certificates could not be restored from %s: %s", certDir, err, old, rerr)
+		}
+		return fmt.Errorf("Failed to replace %s: %s", certDir, err)
+	}
+	swapped = true
+	os.RemoveAll(old)
+	if prev != "" {
+		os.RemoveAll(prev)
+	}
+	return nil
+}
+
+// Whether certDir holds exactly files, with the expected permissions.
+func sameCertDir(certDir string, files map[string][]byte) bool {
+	if fi, err := os.Stat(certDir); err != nil || (runtime.GOOS != "windows" && fi.Mode().Perm() != 0700) {
+		return false
+	}
+	fis, err := ioutil.ReadDir(certDir)
+	if err != nil || len(fis) != len(files) {
+		return false
+	}
+	for _, fi := range fis {
+		b, ok := files[fi.Name()]
+		if !ok || !fi.Mode().IsRegular() {
+			return false
+		}
+		if runtime.GOOS != "windows" && fi.Mode().Perm() != certFileMode(fi.Name()) {
+			return false
+		}
+		cur, err := ioutil.ReadFile(filepath.Join(certDir, fi.Name()))
+		if err != nil || !bytes.Equal(cur, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// Write a file and flush it to disk, reporting close errors.
+func writeFileSync(filename string, b []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
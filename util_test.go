@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+const testIPAddrShow = `1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN group default
+    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00
+    inet 127.0.0.1/8 scope host lo
+       valid_lft forever preferred_lft forever
+2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc pfifo_fast state UP group default qlen 1000
+    link/ether 08:00:27:c2:e4:e1 brd ff:ff:ff:ff:ff:ff
+    inet 10.0.2.15/24 brd 10.0.2.255 scope global eth0
+       valid_lft forever preferred_lft forever
+3: eth1: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc pfifo_fast state UP group default qlen 1000
+    link/ether 08:00:27:0c:5b:7a brd ff:ff:ff:ff:ff:ff
+    inet 192.168.59.103/24 brd 192.168.59.255 scope global eth1
+       valid_lft forever preferred_lft forever
+    inet6 fe80::a00:27ff:fe0c:5b7a/64 scope link
+       valid_lft forever preferred_lft forever
+    inet6 fd00:b2d::a00:27ff:fe0c:5b7a/64 scope global dynamic
+       valid_lft 86398sec preferred_lft 14398sec
+4: eth2: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc pfifo_fast state UP group default qlen 1000
+    link/ether 08:00:27:aa:bb:cc brd ff:ff:ff:ff:ff:ff
+    inet 10.10.1.42/16 brd 10.10.255.255 scope global eth2
+       valid_lft forever preferred_lft forever
+5: docker0: <NO-CARRIER,BROADCAST,MULTICAST,UP> mtu 1500 qdisc noqueue state DOWN group default
+    link/ether 56:84:7a:fe:97:99 brd ff:ff:ff:ff:ff:ff
+    inet 172.17.42.1/16 scope global docker0
+       valid_lft forever preferred_lft forever
+`
+
+func TestVMInterfaceIP(t *testing.T) {
+	for _, tt := range []struct {
+		mac, ip string
+	}{
+		{"", "192.168.59.103"},
+		{"0800270C5B7A", "192.168.59.103"},
+		{"080027AABBCC", "10.10.1.42"},
+	} {
+		ip, err := vmInterfaceIP(testIPAddrShow, tt.mac)
+		if err != nil {
+			t.Errorf("mac %q: %s", tt.mac, err)
+			continue
+		}
+		if ip != tt.ip {
+			t.Errorf("mac %q: got %s, want %s", tt.mac, ip, tt.ip)
+		}
+	}
+
+	if _, err := vmInterfaceIP(testIPAddrShow, "080027000000"); err == nil {
+		t.Error("expected an error for an unknown MAC address")
+	}
+}
+
+func TestVMInterfaceIPv6(t *testing.T) {
+	for _, mac := range []string{"", "0800270C5B7A"} {
+		ip, err := vmInterfaceIPv6(testIPAddrShow, mac)
+		if err != nil {
+			t.Errorf("mac %q: %s", mac, err)
+			continue
+		}
+		if want := "fd00:b2d::a00:27ff:fe0c:5b7a"; ip != want {
+			t.Errorf("mac %q: got %s, want %s", mac, ip, want)
+		}
+	}
+
+	// eth2 only has an IPv4 address.
+	if _, err := vmInterfaceIPv6(testIPAddrShow, "080027AABBCC"); err == nil {
+		t.Error("expected an error for an interface without a global IPv6 address")
+	}
+}
+
+func TestSplitDockerSocket(t *testing.T) {
+	for _, tt := range []struct {
+		socket, host, port string
+	}{
+		{"tcp://192.168.59.103:2376", "192.168.59.103", "2376"},
+		{"tcp://[fd00:b2d::103]:2376", "fd00:b2d::103", "2376"},
+		{"tcp://fd00:b2d::103:2376", "fd00:b2d::103", "2376"},
+		{"tcp://localhost:2375/", "localhost", "2375"},
+	} {
+		host, port, err := splitDockerSocket(tt.socket)
+		if err != nil {
+			t.Errorf("%s: %s", tt.socket, err)
+			continue
+		}
+		if host != tt.host || port != tt.port {
+			t.Errorf("%s: got %s %s, want %s %s", tt.socket, host, port, tt.host, tt.port)
+		}
+	}
+
+	for _, socket := range []string{"unix:///var/run/docker.sock", "tcp://192.168.59.103"} {
+		if _, _, err := splitDockerSocket(socket); err == nil {
+			t.Errorf("%s: expected an error", socket)
+		}
+	}
+}
+
+// Create a PEM encoded client certificate and its key.
+func testKeyPair(t *testing.T) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestWriteCertDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2d-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certDir := filepath.Join(dir, "certs", "boot2docker-vm")
+
+	cert, key := testKeyPair(t)
+	files := map[string][]byte{"ca.pem": cert, "cert.pem": cert, "key.pem": key}
+	if err := writeCertDir(certDir, files); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		for name, want := range map[string]os.FileMode{"": 0700, "key.pem": 0600, "cert.pem": 0644} {
+			fi, err := os.Stat(filepath.Join(certDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != want {
+				t.Errorf("%q: got mode %o, want %o", name, fi.Mode().Perm(), want)
+			}
+		}
+	}
+	if !sameCertDir(certDir, files) {
+		t.Error("written certificates differ")
+	}
+
+	// Unchanged files are left alone.
+	fi, _ := os.Stat(certDir)
+	if err := writeCertDir(certDir, files); err != nil {
+		t.Fatal(err)
+	}
+	if fi2, _ := os.Stat(certDir); !os.SameFile(fi, fi2) {
+		t.Error("unchanged certificates were rewritten")
+	}
+
+	// A key not matching the certificate leaves the current set in place.
+	_, otherKey := testKeyPair(t)
+	bad := map[string][]byte{"ca.pem": cert, "cert.pem": cert, "key.pem": otherKey}
+	if err := writeCertDir(certDir, bad); err == nil {
+		t.Error("expected an error for a mismatched key")
+	}
+	if !sameCertDir(certDir, files) {
+		t.Error("certificates changed after a failed update")
+	}
+
+	// A new set replaces the old one as a whole.
+	cert2, key2 := testKeyPair(t)
+	files2 := map[string][]byte{"cert.pem": cert2, "key.pem": key2}
+	if err := writeCertDir(certDir, files2); err != nil {
+		t.Fatal(err)
+	}
+	if !sameCertDir(certDir, files2) {
+		t.Error("certificates were not replaced")
+	}
+	checkNoLeftovers(t, certDir)
+
+	// A plain directory written by an older version is replaced too.
+	if target, err := filepath.EvalSymlinks(certDir); err == nil {
+		os.RemoveAll(target)
+	}
+	if err := os.RemoveAll(certDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(certDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCertDir(certDir, files); err != nil {
+		t.Fatal(err)
+	}
+	if !sameCertDir(certDir, files) {
+		t.Error("certificates were not replaced")
+	}
+	checkNoLeftovers(t, certDir)
+}
+
+// Check that the directory of certDir only holds it and, if it is a symlink,
+// the directory it points to.
+func checkNoLeftovers(t *testing.T, certDir string) {
+	want := 1
+	if fi, err := os.Lstat(certDir); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		want = 2
+	} else if runtime.GOOS != "windows" {
+		t.Errorf("%s is not a symlink", certDir)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Dir(certDir)); len(entries) != want {
+		t.Errorf("got %d entries next to the certificates, want %d", len(entries), want)
+	}
+}
+
+func TestDockerSocket(t *testing.T) {
+	ip := func() (string, error) { return "192.168.59.103", nil }
+	for _, tt := range []struct {
+		out  string
+		ipv6 bool
+		want string
+	}{
+		{"tcp://0.0.0.0:2376\n", false, "tcp://192.168.59.103:2376"},
+		{"tcp://[::]:2376\n", false, "tcp://192.168.59.103:2376"},
+		{"tcp://192.168.59.103:2375\n", false, "tcp://192.168.59.103:2375"},
+		{"tcp://[::]:2376\n", true, "tcp://192.168.59.103:2376"},
+		// The daemon does not listen on IPv6.
+		{"tcp://0.0.0.0:2376\n", true, ""},
+		{"tcp://192.168.59.103:2376\n", true, ""},
+		{"unix:///var/run/docker.sock\n", false, ""},
+	} {
+		got, err := dockerSocket(tt.out, tt.ipv6, ip)
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("dockerSocket(%q, %v) = %q, %v, want %q", tt.out, tt.ipv6, got, err, tt.want)
+		}
+		if _, ok := err.(fatalError); tt.ipv6 && tt.want == "" && !ok {
+			t.Errorf("dockerSocket(%q, %v): got %v, want a fatal error", tt.out, tt.ipv6, err)
+		}
+	}
+}
+
+// Machine whose driver fails to tell its IP.
+type noIPMachine struct {
+	driver.Machine
+}
+
+func (m noIPMachine) GetIP(ctx context.Context) (string, error) {
+	return "", errors.New("no guest additions")
+}
+
+func TestRequestIP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh is a shell script")
+	}
+	saved := B2D
+	defer func() { B2D = saved }()
+	dir, err := ioutil.TempDir("", "b2d-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fakeSSH(t, dir)
+	B2D.Driver = "dummy"
+	m, err := driver.GetMachine(context.Background(), &B2D)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipScript := filepath.Join(dir, "ip")
+
+	// The VM answers over SSH.
+	if err := ioutil.WriteFile(ipScript, []byte("#!/bin/sh\ncat <<'EOF'\n"+testIPAddrShow+"EOF\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if ip, err := RequestIP(context.Background(), m); err != nil || ip != "192.168.59.103" {
+		t.Errorf("got %q, %v, want 192.168.59.103", ip, err)
+	}
+
+	// Each method that failed is reported, not only the last one.
+	if err := ioutil.WriteFile(ipScript, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RequestIP(context.Background(), m); err == nil || err.Error() != "via SSH: exit status 1" {
+		t.Errorf("got error %v, want only the SSH one", err)
+	}
+	want := "from the driver: no guest additions; via SSH: exit status 1"
+	if _, err := RequestIP(context.Background(), noIPMachine{m}); err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
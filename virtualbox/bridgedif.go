@@ -0,0 +1,69 @@
+package virtualbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// A BridgedIf is a host network interface the VM network can be bridged to.
+type BridgedIf struct {
+	Name   string // e.g. "en0: Wi-Fi (AirPort)"
+	Status string
+}
+
+// BridgedIfs gets all host interfaces available for bridged networking.
+func BridgedIfs(ctx context.Context) ([]BridgedIf, error) {
+	out, err := vbmOut(ctx, "list", "bridgedifs")
+	if err != nil {
+		return nil, err
+	}
+	s := bufio.NewScanner(strings.NewReader(out))
+	ifs := []BridgedIf{}
+	n := BridgedIf{}
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			if n.Name != "" {
+				ifs = append(ifs, n)
+			}
+			n = BridgedIf{}
+			continue
+		}
+		res := reColonLine.FindStringSubmatch(line)
+		if res == nil {
+			continue
+		}
+		switch key, val := res[1], res[2]; key {
+		case "Name":
+			n.Name = val
+		case "Status":
+			n.Status = val
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if n.Name != "" {
+		ifs = append(ifs, n)
+	}
+	return ifs, nil
+}
+
+// Find the bridged interface matching name, either exactly or by its device
+// name (e.g. "en0" for "en0: Wi-Fi (AirPort)").
+func findBridgedIf(ctx context.Context, name string) (string, error) {
+	ifs, err := BridgedIfs(ctx)
+	if err != nil {
+		return "", err
+	}
+	names := []string{}
+	for _, i := range ifs {
+		if i.Name == name || strings.HasPrefix(i.Name, name+":") {
+			return i.Name, nil
+		}
+		names = append(names, i.Name)
+	}
+	return "", fmt.Errorf("host interface %q not found for bridging (available: %s)", name, strings.Join(names, ", "))
+}
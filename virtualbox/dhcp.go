@@ -2,18 +2,19 @@ package virtualbox
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"strings"
 
 	"github.com/boot2docker/boot2docker-cli/driver"
 )
 
-func addDHCP(kind, name string, d driver.DHCP) error {
+func addDHCP(ctx context.Context, kind, name string, d driver.DHCP) error {
 	command := "modify"
 
 	// On some platforms (OSX), creating a hostonlyinterface adds a default dhcpserver
 	// While on others (Windows?) it does not.
-	dhcps, err := DHCPs()
+	dhcps, err := DHCPs(ctx)
 	if err != nil {
 		return err
 	}
@@ -34,22 +35,30 @@ func addDHCP(kind, name string, d driver.DHCP) error {
 	} else {
 		args = append(args, "--disable")
 	}
-	return vbm(args...)
+	return vbm(ctx, args...)
 }
 
 // AddInternalDHCP adds a DHCP server to an internal network.
-func AddInternalDHCP(netname string, d driver.DHCP) error {
-	return addDHCP("--netname", netname, d)
+func AddInternalDHCP(ctx context.Context, netname string, d driver.DHCP) error {
+	return addDHCP(ctx, "--netname", netname, d)
 }
 
+// VirtualBox names the network of a host-only interface after it.
+const hostonlyNetworkPrefix = "HostInterfaceNetworking-"
+
 // AddHostonlyDHCP adds a DHCP server to a host-only network.
-func AddHostonlyDHCP(ifname string, d driver.DHCP) error {
-	return addDHCP("--netname", "HostInterfaceNetworking-"+ifname, d)
+func AddHostonlyDHCP(ctx context.Context, ifname string, d driver.DHCP) error {
+	return addDHCP(ctx, "--netname", hostonlyNetworkPrefix+ifname, d)
+}
+
+// RemoveDHCP removes the DHCP server of the named network.
+func RemoveDHCP(ctx context.Context, netname string) error {
+	return vbm(ctx, "dhcpserver", "remove", "--netname", netname)
 }
 
 // DHCPs gets all DHCP server settings in a map keyed by DHCP.NetworkName.
-func DHCPs() (map[string]*driver.DHCP, error) {
-	out, err := vbmOut("list", "dhcpservers")
+func DHCPs(ctx context.Context) (map[string]*driver.DHCP, error) {
+	out, err := vbmOut(ctx, "list", "dhcpservers")
 	if err != nil {
 		return nil, err
 	}
@@ -1,9 +1,12 @@
 package virtualbox
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestDHCPs(t *testing.T) {
-	m, err := DHCPs()
+	m, err := DHCPs(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1,6 +1,7 @@
 package virtualbox
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -9,10 +10,10 @@ import (
 
 // MakeDiskImage makes a disk image at dest with the given size in MB. If r is
 // not nil, it will be read as a raw disk image to convert from.
-func MakeDiskImage(dest string, size uint, r io.Reader) error {
+func MakeDiskImage(ctx context.Context, dest string, size uint, r io.Reader) error {
 	// Convert a raw image from stdin to the dest VMDK image.
 	sizeBytes := int64(size) << 20 // usually won't fit in 32-bit int (max 2GB)
-	cmd := exec.Command(cfg.VBM, "convertfromraw", "stdin", dest,
+	cmd := exec.CommandContext(ctx, cfg.VBM, "convertfromraw", "stdin", dest,
 		fmt.Sprintf("%d", sizeBytes), "--format", "VMDK")
 
 	if verbose {
@@ -46,7 +47,10 @@ func MakeDiskImage(dest string, size uint, r io.Reader) error {
 		return err
 	}
 
-	return cmd.Wait()
+	if err := cmd.Wait(); err != nil {
+		return vbmError(ctx, err)
+	}
+	return nil
 }
 
 // ZeroFill writes n zero bytes into w.
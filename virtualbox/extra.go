@@ -1,11 +1,13 @@
 package virtualbox
 
+import "context"
+
 // SetExtra sets extra data. Name could be "global"|<uuid>|<vmname>
-func SetExtra(name, key, val string) error {
-	return vbm("setextradata", name, key, val)
+func SetExtra(ctx context.Context, name, key, val string) error {
+	return vbm(ctx, "setextradata", name, key, val)
 }
 
 // DelExtraData deletes extra data. Name could be "global"|<uuid>|<vmname>
-func DelExtra(name, key string) error {
-	return vbm("setextradata", name, key)
+func DelExtra(ctx context.Context, name, key string) error {
+	return vbm(ctx, "setextradata", name, key)
 }
@@ -0,0 +1,102 @@
+package virtualbox
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// How long GetIP waits, once, for the guest additions to publish the address
+// of a booting VM.
+const guestIPWait = 2 * time.Second
+
+// Value of a guest property as printed by `guestproperty get`, empty when it
+// is not set.
+func parseGuestProperty(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "Value: ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Value: "))
+		}
+	}
+	return ""
+}
+
+func (m *Machine) guestProperty(ctx context.Context, name string) (string, error) {
+	out, err := vbmOut(ctx, "guestproperty", "get", m.Name, name)
+	if err != nil {
+		return "", err
+	}
+	return parseGuestProperty(out), nil
+}
+
+// Index of the guest interface the guest additions report with mac, or of the
+// second one (the host-only or bridged NIC) when mac is empty.
+func (m *Machine) guestNetIndex(ctx context.Context, mac string) (int, error) {
+	val, err := m.guestProperty(ctx, "/VirtualBox/GuestInfo/Net/Count")
+	if err != nil {
+		return -1, err
+	}
+	count, err := strconv.Atoi(val)
+	if err != nil {
+		return -1, fmt.Errorf("the guest additions of %q report no network interfaces", m.Name)
+	}
+	if mac == "" {
+		if count < 2 {
+			return -1, fmt.Errorf("the guest additions of %q report no VM network interface", m.Name)
+		}
+		return 1, nil
+	}
+	for i := 0; i < count; i++ {
+		val, err := m.guestProperty(ctx, fmt.Sprintf("/VirtualBox/GuestInfo/Net/%d/MAC", i))
+		if err != nil {
+			return -1, err
+		}
+		if strings.EqualFold(val, mac) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("the guest additions of %q report no interface with MAC address %s", m.Name, mac)
+}
+
+// GetIP returns the IPv4 address of the VM network interface (the second
+// NIC) as published by the guest additions, without logging in the VM. It
+// fails right away while the guest additions publish no interfaces, and only
+// waits for the address on the first call, so that callers retrying it are
+// not slowed down.
+func (m *Machine) GetIP(ctx context.Context) (string, error) {
+	if m.State != driver.Running {
+		return "", fmt.Errorf("machine %q is not running", m.Name)
+	}
+	mac := ""
+	for _, nic := range m.NICs {
+		if nic.Slot == 2 {
+			mac = strings.Replace(nic.MacAddr, ":", "", -1)
+		}
+	}
+	i, err := m.guestNetIndex(ctx, mac)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("/VirtualBox/GuestInfo/Net/%d/V4/IP", i)
+	ip, err := m.guestProperty(ctx, name)
+	if err != nil || ip != "" {
+		return ip, err
+	}
+	if m.ipWaited {
+		return "", fmt.Errorf("the guest additions of %q report no IP address", m.Name)
+	}
+	// Not published yet: wait for it a bit (the wait fails on timeout).
+	m.ipWaited = true
+	vbmOut(ctx, "guestproperty", "wait", m.Name, name, "--timeout", strconv.Itoa(int(guestIPWait/time.Millisecond)))
+	if ip, err = m.guestProperty(ctx, name); err != nil {
+		return "", err
+	}
+	if ip == "" {
+		return "", fmt.Errorf("the guest additions of %q report no IP address", m.Name)
+	}
+	return ip, nil
+}
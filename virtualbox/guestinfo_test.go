@@ -0,0 +1,19 @@
+package virtualbox
+
+import "testing"
+
+func TestParseGuestProperty(t *testing.T) {
+	tests := []struct {
+		out, want string
+	}{
+		{"Value: 192.168.59.103\n", "192.168.59.103"},
+		{"Value: 080027C2E4E1\r\n", "080027C2E4E1"},
+		{"No value set!\n", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := parseGuestProperty(test.out); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.out, got, test.want)
+		}
+	}
+}
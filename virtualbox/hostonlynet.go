@@ -2,12 +2,15 @@ package virtualbox
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
 )
 
 var (
@@ -32,8 +35,8 @@ type HostonlyNet struct {
 }
 
 // CreateHostonlyNet creates a new host-only network.
-func CreateHostonlyNet() (*HostonlyNet, error) {
-	out, err := vbmOut("hostonlyif", "create")
+func CreateHostonlyNet(ctx context.Context) (*HostonlyNet, error) {
+	out, err := vbmOut(ctx, "hostonlyif", "create")
 	if err != nil {
 		return nil, err
 	}
@@ -44,31 +47,36 @@ func CreateHostonlyNet() (*HostonlyNet, error) {
 	return &HostonlyNet{Name: res[1]}, nil
 }
 
+// Remove deletes the host-only network interface.
+func (n *HostonlyNet) Remove(ctx context.Context) error {
+	return vbm(ctx, "hostonlyif", "remove", n.Name)
+}
+
 // Config changes the configuration of the host-only network.
-func (n *HostonlyNet) Config() error {
+func (n *HostonlyNet) Config(ctx context.Context) error {
 	if n.IPv4.IP != nil && n.IPv4.Mask != nil {
-		if err := vbm("hostonlyif", "ipconfig", n.Name, "--ip", n.IPv4.IP.String(), "--netmask", net.IP(n.IPv4.Mask).String()); err != nil {
+		if err := vbm(ctx, "hostonlyif", "ipconfig", n.Name, "--ip", n.IPv4.IP.String(), "--netmask", net.IP(n.IPv4.Mask).String()); err != nil {
 			return err
 		}
 	}
 
 	if n.IPv6.IP != nil && n.IPv6.Mask != nil {
 		prefixLen, _ := n.IPv6.Mask.Size()
-		if err := vbm("hostonlyif", "ipconfig", n.Name, "--ipv6", n.IPv6.IP.String(), "--netmasklengthv6", fmt.Sprintf("%d", prefixLen)); err != nil {
+		if err := vbm(ctx, "hostonlyif", "ipconfig", n.Name, "--ipv6", n.IPv6.IP.String(), "--netmasklengthv6", fmt.Sprintf("%d", prefixLen)); err != nil {
 			return err
 		}
 	}
 
 	if n.DHCP {
-		vbm("hostonlyif", "ipconfig", n.Name, "--dhcp") // not implemented as of VirtualBox 4.3
+		vbm(ctx, "hostonlyif", "ipconfig", n.Name, "--dhcp") // not implemented as of VirtualBox 4.3
 	}
 
 	return nil
 }
 
 // HostonlyNets gets all host-only networks in a  map keyed by HostonlyNet.NetworkName.
-func HostonlyNets() (map[string]*HostonlyNet, error) {
-	out, err := vbmOut("list", "hostonlyifs")
+func HostonlyNets(ctx context.Context) (map[string]*HostonlyNet, error) {
+	out, err := vbmOut(ctx, "list", "hostonlyifs")
 	if err != nil {
 		return nil, err
 	}
@@ -124,3 +132,65 @@ func HostonlyNets() (map[string]*HostonlyNet, error) {
 	}
 	return m, nil
 }
+
+// PruneHostonlyNets removes the host-only networks not attached to any
+// registered machine, together with their DHCP servers, as well as DHCP
+// servers left behind by host-only networks that no longer exist. It returns
+// the names of the removed interfaces and DHCP networks.
+func PruneHostonlyNets(ctx context.Context) ([]string, error) {
+	names, err := ListMachines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, name := range names {
+		m, err := GetMachine(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, nic := range m.NICs {
+			if nic.Network == driver.NICNetHostonly {
+				used[nic.Adapter] = true
+			}
+		}
+	}
+
+	nets, err := HostonlyNets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dhcps, err := DHCPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for netname, n := range nets {
+		if used[n.Name] {
+			continue
+		}
+		if _, ok := dhcps[netname]; ok {
+			if err := RemoveDHCP(ctx, netname); err != nil {
+				return removed, err
+			}
+			delete(dhcps, netname)
+		}
+		if err := n.Remove(ctx); err != nil {
+			return removed, err
+		}
+		removed = append(removed, n.Name)
+	}
+	for netname := range dhcps {
+		if !strings.HasPrefix(netname, hostonlyNetworkPrefix) {
+			continue
+		}
+		if _, ok := nets[netname]; ok {
+			continue
+		}
+		if err := RemoveDHCP(ctx, netname); err != nil {
+			return removed, err
+		}
+		removed = append(removed, netname)
+	}
+	return removed, nil
+}
@@ -1,9 +1,12 @@
 package virtualbox
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestHostonlyNets(t *testing.T) {
-	m, err := HostonlyNets()
+	m, err := HostonlyNets(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
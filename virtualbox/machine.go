@@ -4,13 +4,13 @@ import (
 	"archive/tar"
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"time"
 
@@ -63,19 +63,41 @@ func init() {
 		fmt.Fprintf(os.Stderr, "Failed to initialize driver config. Error : %s", err.Error())
 		os.Exit(1)
 	}
+	if err := driver.RegisterList("virtualbox", ListFunc); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize driver list. Error : %s", err.Error())
+		os.Exit(1)
+	}
+	if err := driver.RegisterPruneNetworks("virtualbox", PruneFunc); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize driver network pruning. Error : %s", err.Error())
+		os.Exit(1)
+	}
 }
 
 // Initialize the Machine.
-func InitFunc(mc *driver.MachineConfig) (driver.Machine, error) {
+func InitFunc(ctx context.Context, mc *driver.MachineConfig) (driver.Machine, error) {
 	verbose = mc.Verbose
 
-	m, err := GetMachine(mc.VM)
+	m, err := GetMachine(ctx, mc.VM)
 	if err != nil && mc.Init {
-		return CreateMachine(mc)
+		return CreateMachine(ctx, mc)
 	}
 	return m, err
 }
 
+// List the registered machines.
+func ListFunc(ctx context.Context, mc *driver.MachineConfig) ([]string, error) {
+	verbose = mc.Verbose
+
+	return ListMachines(ctx)
+}
+
+// Remove the host-only networks and DHCP servers no machine uses.
+func PruneFunc(ctx context.Context, mc *driver.MachineConfig) ([]string, error) {
+	verbose = mc.Verbose
+
+	return PruneHostonlyNets(ctx)
+}
+
 type shareSlice map[string]string
 
 const shareSliceSep = "="
@@ -173,133 +195,155 @@ type Machine struct {
 	DockerPort uint
 	SSHPort    uint
 	SerialFile string
+
+	NICs                  []NICInfo
+	StorageCtls           []StorageCtlInfo
+	Storage               []StorageAttachment
+	SharedFolders         map[string]string // share name => host path
+	Snapshots             []Snapshot
+	CurrentSnapshot       string
+	GuestAdditionsVersion string // e.g. "4.3.20", empty if not reported
+
+	ipWaited bool // GetIP already waited for the guest additions
 }
 
 // Refresh reloads the machine information.
-func (m *Machine) Refresh() error {
+func (m *Machine) Refresh(ctx context.Context) error {
 	id := m.Name
 	if id == "" {
 		id = m.UUID
 	}
-	mm, err := GetMachine(id)
+	mm, err := GetMachine(ctx, id)
 	if err != nil {
 		return err
 	}
+	waited := m.ipWaited
 	*m = *mm
+	m.ipWaited = waited
 	return nil
 }
 
 // Start starts the machine.
-func (m *Machine) Start() error {
+func (m *Machine) Start(ctx context.Context) error {
 	switch m.State {
 	case driver.Paused:
-		return vbm("controlvm", m.Name, "resume")
+		return vbm(ctx, "controlvm", m.Name, "resume")
 	case driver.Poweroff, driver.Aborted:
-		if err := m.setUpShares(); err != nil {
+		if err := m.setUpShares(ctx); err != nil {
 			return err
 		}
 		fallthrough
 	case driver.Saved:
-		return vbm("startvm", m.Name, "--type", "headless")
+		return vbm(ctx, "startvm", m.Name, "--type", "headless")
 	}
-	if err := m.Refresh(); err == nil {
+	if err := m.Refresh(ctx); err == nil {
 		if m.State != driver.Running {
-			return fmt.Errorf("Failed to start", m.Name)
+			return fmt.Errorf("Failed to start %s", m.Name)
 		}
 	}
 	return nil
 }
 
 // Suspend suspends the machine and saves its state to disk.
-func (m *Machine) Save() error {
+func (m *Machine) Save(ctx context.Context) error {
 	switch m.State {
 	case driver.Paused:
-		if err := m.Start(); err != nil {
+		if err := m.Start(ctx); err != nil {
 			return err
 		}
 	case driver.Poweroff, driver.Aborted, driver.Saved:
 		return nil
 	}
-	return vbm("controlvm", m.Name, "savestate")
+	return vbm(ctx, "controlvm", m.Name, "savestate")
 }
 
 // Pause pauses the execution of the machine.
-func (m *Machine) Pause() error {
+func (m *Machine) Pause(ctx context.Context) error {
 	switch m.State {
 	case driver.Paused, driver.Poweroff, driver.Aborted, driver.Saved:
 		return nil
 	}
-	return vbm("controlvm", m.Name, "pause")
+	return vbm(ctx, "controlvm", m.Name, "pause")
 }
 
 // Stop gracefully stops the machine.
-func (m *Machine) Stop() error {
+func (m *Machine) Stop(ctx context.Context) error {
 	switch m.State {
 	case driver.Poweroff, driver.Aborted, driver.Saved:
 		return nil
 	case driver.Paused:
-		if err := m.Start(); err != nil {
+		if err := m.Start(ctx); err != nil {
 			return err
 		}
 	}
 
-	// busy wait until the machine is stopped
-	for i := 0; i < 10; i++ {
-		if err := vbm("controlvm", m.Name, "acpipowerbutton"); err != nil {
-			return err
+	// Press the power button until the machine is stopped, or ctx is done
+	// (e.g. its deadline is the stop timeout).
+	for {
+		if err := vbm(ctx, "controlvm", m.Name, "acpipowerbutton"); err != nil {
+			return stopError(ctx, err)
 		}
-		time.Sleep(1 * time.Second)
-		if err := m.Refresh(); err != nil {
-			return err
+		select {
+		case <-ctx.Done():
+			return stopError(ctx, ctx.Err())
+		case <-time.After(1 * time.Second):
+		}
+		if err := m.Refresh(ctx); err != nil {
+			return stopError(ctx, err)
 		}
 		if m.State == driver.Poweroff {
 			return nil
 		}
 	}
+}
 
-	return fmt.Errorf("timed out waiting for VM to stop")
+func stopError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out waiting for VM to stop")
+	}
+	return err
 }
 
 // Poweroff forcefully stops the machine. State is lost and might corrupt the disk image.
-func (m *Machine) Poweroff() error {
+func (m *Machine) Poweroff(ctx context.Context) error {
 	switch m.State {
 	case driver.Poweroff, driver.Aborted, driver.Saved:
 		return nil
 	}
-	return vbm("controlvm", m.Name, "poweroff")
+	return vbm(ctx, "controlvm", m.Name, "poweroff")
 }
 
 // Restart gracefully restarts the machine.
-func (m *Machine) Restart() error {
+func (m *Machine) Restart(ctx context.Context) error {
 	switch m.State {
 	case driver.Paused, driver.Saved:
-		if err := m.Start(); err != nil {
+		if err := m.Start(ctx); err != nil {
 			return err
 		}
 	}
-	if err := m.Stop(); err != nil {
+	if err := m.Stop(ctx); err != nil {
 		return err
 	}
-	return m.Start()
+	return m.Start(ctx)
 }
 
 // Reset forcefully restarts the machine. State is lost and might corrupt the disk image.
-func (m *Machine) Reset() error {
+func (m *Machine) Reset(ctx context.Context) error {
 	switch m.State {
 	case driver.Paused, driver.Saved:
-		if err := m.Start(); err != nil {
+		if err := m.Start(ctx); err != nil {
 			return err
 		}
 	}
-	return vbm("controlvm", m.Name, "reset")
+	return vbm(ctx, "controlvm", m.Name, "reset")
 }
 
 // Delete deletes the machine and associated disk images.
-func (m *Machine) Delete() error {
-	if err := m.Poweroff(); err != nil {
+func (m *Machine) Delete(ctx context.Context) error {
+	if err := m.Poweroff(ctx); err != nil {
 		return err
 	}
-	return vbm("unregistervm", m.Name, "--delete")
+	return vbm(ctx, "unregistervm", m.Name, "--delete")
 }
 
 // Get current state
@@ -312,6 +356,44 @@ func (m *Machine) GetState() driver.MachineState {
 	return m.State
 }
 
+// Get driver-independent machine information
+func (m *Machine) GetInfo() driver.MachineInfo {
+	info := driver.MachineInfo{
+		Name:           m.Name,
+		UUID:           m.UUID,
+		Driver:         "virtualbox",
+		State:          m.State,
+		CPUs:           m.CPUs,
+		Memory:         m.Memory,
+		SSHPort:        m.SSHPort,
+		DockerPort:     m.DockerPort,
+		SerialFile:     m.SerialFile,
+		ISO:            m.Iso,
+		Disks:          []string{},
+		NICs:           []driver.NICInfo{},
+		SharedFolders:  m.SharedFolders,
+		GuestAdditions: m.GuestAdditionsVersion,
+	}
+	for _, a := range m.Storage {
+		if a.Medium != m.Iso && a.Medium != "emptydrive" {
+			info.Disks = append(info.Disks, a.Medium)
+		}
+	}
+	for _, n := range m.NICs {
+		info.NICs = append(info.NICs, driver.NICInfo{
+			Slot:     n.Slot,
+			Network:  n.Network,
+			Hardware: n.Hardware,
+			Adapter:  n.Adapter,
+			MacAddr:  n.MacAddr,
+		})
+	}
+	if info.SharedFolders == nil {
+		info.SharedFolders = map[string]string{}
+	}
+	return info
+}
+
 // Get serial file
 func (m *Machine) GetSerialFile() string {
 	return m.SerialFile
@@ -328,94 +410,20 @@ func (m *Machine) GetSSHPort() uint {
 }
 
 // GetMachine finds a machine by its name or UUID.
-func GetMachine(id string) (*Machine, error) {
-	stdout, stderr, err := vbmOutErr("showvminfo", id, "--machinereadable")
+func GetMachine(ctx context.Context, id string) (*Machine, error) {
+	stdout, stderr, err := vbmOutErr(ctx, "showvminfo", id, "--machinereadable")
 	if err != nil {
 		if reMachineNotFound.FindString(stderr) != "" {
 			return nil, driver.ErrMachineNotExist
 		}
 		return nil, err
 	}
-	s := bufio.NewScanner(strings.NewReader(stdout))
-	m := &Machine{}
-	for s.Scan() {
-		res := reVMInfoLine.FindStringSubmatch(s.Text())
-		if res == nil {
-			continue
-		}
-		key := res[1]
-		if key == "" {
-			key = res[2]
-		}
-		val := res[3]
-		if val == "" {
-			val = res[4]
-		}
-
-		switch key {
-		case "name":
-			m.Name = val
-		case "UUID":
-			m.UUID = val
-		case "SATA-0-0":
-			m.Iso = val
-		case "VMState":
-			m.State = driver.MachineState(val)
-		case "memory":
-			n, err := strconv.ParseUint(val, 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			m.Memory = uint(n)
-		case "cpus":
-			n, err := strconv.ParseUint(val, 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			m.CPUs = uint(n)
-		case "vram":
-			n, err := strconv.ParseUint(val, 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			m.VRAM = uint(n)
-		case "CfgFile":
-			m.CfgFile = val
-			m.BaseFolder = filepath.Dir(val)
-		case "uartmode1":
-			// uartmode1="server,/home/sven/.boot2docker/boot2docker-vm.sock"
-			vals := strings.Split(val, ",")
-			if len(vals) >= 2 {
-				m.SerialFile = vals[1]
-			}
-		default:
-			if strings.HasPrefix(key, "Forwarding(") {
-				// "Forwarding(\d*)" are ordered by the name inside the val, not fixed order.
-				// Forwarding(0)="docker,tcp,127.0.0.1,5555,,"
-				// Forwarding(1)="ssh,tcp,127.0.0.1,2222,,22"
-				vals := strings.Split(val, ",")
-				n, err := strconv.ParseUint(vals[3], 10, 32)
-				if err != nil {
-					return nil, err
-				}
-				switch vals[0] {
-				case "docker":
-					m.DockerPort = uint(n)
-				case "ssh":
-					m.SSHPort = uint(n)
-				}
-			}
-		}
-	}
-	if err := s.Err(); err != nil {
-		return nil, err
-	}
-	return m, nil
+	return parseMachineInfo(stdout)
 }
 
 // ListMachines lists all registered machines.
-func ListMachines() ([]string, error) {
-	out, err := vbmOut("list", "vms")
+func ListMachines(ctx context.Context) ([]string, error) {
+	out, err := vbmOut(ctx, "list", "vms")
 	if err != nil {
 		return nil, err
 	}
@@ -435,13 +443,15 @@ func ListMachines() ([]string, error) {
 }
 
 // CreateMachine creates a new machine. If basefolder is empty, use default.
-func CreateMachine(mc *driver.MachineConfig) (*Machine, error) {
+// Each completed step is rolled back if a later one fails, unless
+// mc.KeepOnFailure is set, so that a failed creation can be retried.
+func CreateMachine(ctx context.Context, mc *driver.MachineConfig) (m *Machine, err error) {
 	if mc.VM == "" {
 		return nil, fmt.Errorf("machine name is empty")
 	}
 
 	// Check if a machine with the given name already exists.
-	machineNames, err := ListMachines()
+	machineNames, err := ListMachines(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -451,19 +461,42 @@ func CreateMachine(mc *driver.MachineConfig) (*Machine, error) {
 		}
 	}
 
+	// Check the VM network settings before creating anything.
+	bridgeIFName := ""
+	switch mc.Network {
+	case "", string(driver.NICNetHostonly):
+	case string(driver.NICNetBridged):
+		if mc.BridgeAdapter == "" {
+			return nil, fmt.Errorf("bridged network requires a host interface (--bridge-adapter)")
+		}
+		if bridgeIFName, err = findBridgedIf(ctx, mc.BridgeAdapter); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported network type %q (expected hostonly or bridged)", mc.Network)
+	}
+	if mc.HostIPv6 != nil && (mc.HostIPv6.To4() != nil || mc.IPv6PrefixLen == 0 || mc.IPv6PrefixLen > 128) {
+		return nil, fmt.Errorf("invalid host-only IPv6 network %s/%d", mc.HostIPv6, mc.IPv6PrefixLen)
+	}
+
 	// Create and register the machine.
 	args := []string{"createvm", "--name", mc.VM, "--register"}
-	if err := vbm(args...); err != nil {
+	if err := vbm(ctx, args...); err != nil {
 		return nil, err
 	}
+	var rb rollback
+	defer rb.onError(&err, mc.KeepOnFailure)
+	rb.add(fmt.Sprintf("unregister and delete VM %q", mc.VM), func(ctx context.Context) error {
+		return vbm(ctx, "unregistervm", mc.VM, "--delete")
+	})
 
-	m, err := GetMachine(mc.VM)
+	m, err = GetMachine(ctx, mc.VM)
 	if err != nil {
 		return nil, err
 	}
 
 	// Configure VM for Boot2docker
-	SetExtra(mc.VM, "VBoxInternal/CPUM/EnableHVP", "1")
+	SetExtra(ctx, mc.VM, "VBoxInternal/CPUM/EnableHVP", "1")
 	m.OSType = "Linux26_64"
 	if mc.CPUs > 0 {
 		m.CPUs = mc.CPUs
@@ -476,7 +509,7 @@ func CreateMachine(mc *driver.MachineConfig) (*Machine, error) {
 	m.Memory = mc.Memory
 	m.SerialFile = mc.SerialFile
 
-	m.Flag |= F_pae
+	m.Flag = F_pae
 	m.Flag |= F_longmode // important: use x86-64 processor
 	m.Flag |= F_rtcuseutc
 	m.Flag |= F_acpi
@@ -489,12 +522,12 @@ func CreateMachine(mc *driver.MachineConfig) (*Machine, error) {
 
 	// Set VM boot order
 	m.BootOrder = []string{"dvd"}
-	if err := m.Modify(); err != nil {
+	if err := m.Modify(ctx); err != nil {
 		return m, err
 	}
 
 	// Set NIC #1 to use NAT
-	m.SetNIC(1, driver.NIC{Network: driver.NICNetNAT, Hardware: driver.VirtIO})
+	m.SetNIC(ctx, 1, driver.NIC{Network: driver.NICNetNAT, Hardware: driver.VirtIO})
 	pfRules := map[string]driver.PFRule{
 		"ssh": {Proto: driver.PFTCP, HostIP: net.ParseIP("127.0.0.1"), HostPort: mc.SSHPort, GuestPort: driver.SSHPort},
 	}
@@ -503,28 +536,35 @@ func CreateMachine(mc *driver.MachineConfig) (*Machine, error) {
 	}
 
 	for name, rule := range pfRules {
-		if err := m.AddNATPF(1, name, rule); err != nil {
+		if err := m.AddNATPF(ctx, 1, name, rule); err != nil {
 			return m, err
 		}
 	}
 
-	hostIFName, err := getHostOnlyNetworkInterface(mc)
-	if err != nil {
-		return m, err
-	}
+	if bridgeIFName != "" {
+		// Set NIC #2 to bridge to the host interface
+		if err := m.SetNIC(ctx, 2, driver.NIC{Network: driver.NICNetBridged, Hardware: driver.VirtIO, BridgeAdapter: bridgeIFName}); err != nil {
+			return m, err
+		}
+	} else {
+		hostIFName, err := getHostOnlyNetworkInterface(ctx, mc, &rb)
+		if err != nil {
+			return m, err
+		}
 
-	// Set NIC #2 to use host-only
-	if err := m.SetNIC(2, driver.NIC{Network: driver.NICNetHostonly, Hardware: driver.VirtIO, HostonlyAdapter: hostIFName}); err != nil {
-		return m, err
+		// Set NIC #2 to use host-only
+		if err := m.SetNIC(ctx, 2, driver.NIC{Network: driver.NICNetHostonly, Hardware: driver.VirtIO, HostonlyAdapter: hostIFName}); err != nil {
+			return m, err
+		}
 	}
 
 	// Set VM storage
-	if err := m.AddStorageCtl("SATA", driver.StorageController{SysBus: driver.SysBusSATA, HostIOCache: true, Bootable: true, Ports: 4}); err != nil {
+	if err := m.AddStorageCtl(ctx, "SATA", driver.StorageController{SysBus: driver.SysBusSATA, HostIOCache: true, Bootable: true, Ports: 4}); err != nil {
 		return m, err
 	}
 
 	// Attach ISO image
-	if err := m.AttachStorage("SATA", driver.StorageMedium{Port: 0, Device: 0, DriveType: driver.DriveDVD, Medium: mc.ISO}); err != nil {
+	if err := m.AttachStorage(ctx, "SATA", driver.StorageMedium{Port: 0, Device: 0, DriveType: driver.DriveDVD, Medium: mc.ISO}); err != nil {
 		return m, err
 	}
 
@@ -534,6 +574,14 @@ func CreateMachine(mc *driver.MachineConfig) (*Machine, error) {
 			return m, err
 		}
 
+		// Registered before the attempt, as a failed one may leave a
+		// partial image behind.
+		rb.add(fmt.Sprintf("delete disk image %s", diskImg), func(ctx context.Context) error {
+			if err := os.Remove(diskImg); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		})
 		if cfg.VMDK != "" {
 			if err := copyDiskImage(diskImg, cfg.VMDK); err != nil {
 				return m, err
@@ -579,7 +627,7 @@ func CreateMachine(mc *driver.MachineConfig) (*Machine, error) {
 				return m, err
 			}
 
-			if err := makeDiskImage(diskImg, mc.DiskSize, buf.Bytes()); err != nil {
+			if err := makeDiskImage(ctx, diskImg, mc.DiskSize, buf.Bytes()); err != nil {
 				return m, err
 			}
 			if verbose {
@@ -589,19 +637,19 @@ func CreateMachine(mc *driver.MachineConfig) (*Machine, error) {
 		}
 	}
 
-	if err := m.AttachStorage("SATA", driver.StorageMedium{Port: 1, Device: 0, DriveType: driver.DriveHDD, Medium: diskImg}); err != nil {
+	if err := m.AttachStorage(ctx, "SATA", driver.StorageMedium{Port: 1, Device: 0, DriveType: driver.DriveHDD, Medium: diskImg}); err != nil {
 		return m, err
 	}
 
 	return m, nil
 }
 
-func (m *Machine) setUpShares() error {
+func (m *Machine) setUpShares(ctx context.Context) error {
 	// let VBoxService do nice magic automounting (when it's used)
-	if err := vbm("guestproperty", "set", m.Name, "/VirtualBox/GuestAdd/SharedFolders/MountPrefix", "/"); err != nil {
+	if err := vbm(ctx, "guestproperty", "set", m.Name, "/VirtualBox/GuestAdd/SharedFolders/MountPrefix", "/"); err != nil {
 		return err
 	}
-	if err := vbm("guestproperty", "set", m.Name, "/VirtualBox/GuestAdd/SharedFolders/MountDir", "/"); err != nil {
+	if err := vbm(ctx, "guestproperty", "set", m.Name, "/VirtualBox/GuestAdd/SharedFolders/MountDir", "/"); err != nil {
 		return err
 	}
 
@@ -618,12 +666,12 @@ func (m *Machine) setUpShares() error {
 		}
 
 		// woo, shareDir exists!  let's carry on!
-		if err := vbm("sharedfolder", "add", m.Name, "--name", shareName, "--hostpath", shareDir, "--automount"); err != nil {
+		if err := vbm(ctx, "sharedfolder", "add", m.Name, "--name", shareName, "--hostpath", shareDir, "--automount"); err != nil {
 			return err
 		}
 
 		// enable symlinks
-		if err := vbm("setextradata", m.Name, "VBoxInternal2/SharedFoldersEnableSymlinksCreate/"+shareName, "1"); err != nil {
+		if err := vbm(ctx, "setextradata", m.Name, "VBoxInternal2/SharedFoldersEnableSymlinksCreate/"+shareName, "1"); err != nil {
 			return err
 		}
 	}
@@ -631,7 +679,7 @@ func (m *Machine) setUpShares() error {
 }
 
 // Modify changes the settings of the machine.
-func (m *Machine) Modify() error {
+func (m *Machine) Modify(ctx context.Context) error {
 	args := []string{"modifyvm", m.Name,
 		"--firmware", "bios",
 		"--bioslogofadein", "off",
@@ -680,39 +728,66 @@ func (m *Machine) Modify() error {
 		}
 		args = append(args, fmt.Sprintf("--boot%d", i+1), dev)
 	}
-	if err := vbm(args...); err != nil {
+	if err := vbm(ctx, args...); err != nil {
 		return err
 	}
-	return m.Refresh()
+	return m.Refresh(ctx)
 }
 
 // AddNATPF adds a NAT port forarding rule to the n-th NIC with the given name.
-func (m *Machine) AddNATPF(n int, name string, rule driver.PFRule) error {
-	return vbm("modifyvm", m.Name, fmt.Sprintf("--natpf%d", n),
+// Rules of a running machine are changed live with `controlvm`, otherwise the
+// machine settings are modified.
+func (m *Machine) AddNATPF(ctx context.Context, n int, name string, rule driver.PFRule) error {
+	if m.isLive() {
+		return vbm(ctx, "controlvm", m.Name, fmt.Sprintf("natpf%d", n),
+			fmt.Sprintf("%s,%s", name, rule.Format()))
+	}
+	return vbm(ctx, "modifyvm", m.Name, fmt.Sprintf("--natpf%d", n),
 		fmt.Sprintf("%s,%s", name, rule.Format()))
 }
 
 // DelNATPF deletes the NAT port forwarding rule with the given name from the n-th NIC.
-func (m *Machine) DelNATPF(n int, name string) error {
-	return vbm("controlvm", m.Name, fmt.Sprintf("natpf%d", n), "delete", name)
+func (m *Machine) DelNATPF(ctx context.Context, n int, name string) error {
+	if m.isLive() {
+		return vbm(ctx, "controlvm", m.Name, fmt.Sprintf("natpf%d", n), "delete", name)
+	}
+	return vbm(ctx, "modifyvm", m.Name, fmt.Sprintf("--natpf%d", n), "delete", name)
+}
+
+// GetNATPFRules returns the NAT port forwarding rules of the n-th NIC keyed by name.
+func (m *Machine) GetNATPFRules(n int) map[string]driver.PFRule {
+	for _, nic := range m.NICs {
+		if nic.Slot == n {
+			return nic.PFRules
+		}
+	}
+	return map[string]driver.PFRule{}
+}
+
+// isLive reports whether the machine settings can only be changed through `controlvm`.
+func (m *Machine) isLive() bool {
+	return m.State == driver.Running || m.State == driver.Paused
 }
 
 // SetNIC set the n-th NIC.
-func (m *Machine) SetNIC(n int, nic driver.NIC) error {
+func (m *Machine) SetNIC(ctx context.Context, n int, nic driver.NIC) error {
 	args := []string{"modifyvm", m.Name,
 		fmt.Sprintf("--nic%d", n), string(nic.Network),
 		fmt.Sprintf("--nictype%d", n), string(nic.Hardware),
 		fmt.Sprintf("--cableconnected%d", n), "on",
 	}
 
-	if nic.Network == "hostonly" {
+	switch nic.Network {
+	case driver.NICNetHostonly:
 		args = append(args, fmt.Sprintf("--hostonlyadapter%d", n), nic.HostonlyAdapter)
+	case driver.NICNetBridged:
+		args = append(args, fmt.Sprintf("--bridgeadapter%d", n), nic.BridgeAdapter)
 	}
-	return vbm(args...)
+	return vbm(ctx, args...)
 }
 
 // AddStorageCtl adds a storage controller with the given name.
-func (m *Machine) AddStorageCtl(name string, ctl driver.StorageController) error {
+func (m *Machine) AddStorageCtl(ctx context.Context, name string, ctl driver.StorageController) error {
 	args := []string{"storagectl", m.Name, "--name", name}
 	if ctl.SysBus != "" {
 		args = append(args, "--add", string(ctl.SysBus))
@@ -725,17 +800,17 @@ func (m *Machine) AddStorageCtl(name string, ctl driver.StorageController) error
 	}
 	args = append(args, "--hostiocache", bool2string(ctl.HostIOCache))
 	args = append(args, "--bootable", bool2string(ctl.Bootable))
-	return vbm(args...)
+	return vbm(ctx, args...)
 }
 
 // DelStorageCtl deletes the storage controller with the given name.
-func (m *Machine) DelStorageCtl(name string) error {
-	return vbm("storagectl", m.Name, "--name", name, "--remove")
+func (m *Machine) DelStorageCtl(ctx context.Context, name string) error {
+	return vbm(ctx, "storagectl", m.Name, "--name", name, "--remove")
 }
 
 // AttachStorage attaches a storage medium to the named storage controller.
-func (m *Machine) AttachStorage(ctlName string, medium driver.StorageMedium) error {
-	return vbm("storageattach", m.Name, "--storagectl", ctlName,
+func (m *Machine) AttachStorage(ctx context.Context, ctlName string, medium driver.StorageMedium) error {
+	return vbm(ctx, "storageattach", m.Name, "--storagectl", ctlName,
 		"--port", fmt.Sprintf("%d", medium.Port),
 		"--device", fmt.Sprintf("%d", medium.Device),
 		"--type", string(medium.DriveType),
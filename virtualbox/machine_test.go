@@ -1,9 +1,16 @@
 package virtualbox
 
-import "testing"
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
 
 func TestMachine(t *testing.T) {
-	ms, err := ListMachines()
+	ms, err := ListMachines(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -11,3 +18,117 @@ func TestMachine(t *testing.T) {
 		t.Logf("%+v", m)
 	}
 }
+
+const testVMInfo = `name="boot2docker-vm"
+UUID="2b0c6b6c-8c4e-4f2e-9a8e-2d6a0e0d6c1a"
+CfgFile="/Users/sven/VirtualBox VMs/boot2docker-vm/boot2docker-vm.vbox"
+memory=2048
+vram=8
+cpus=2
+acpi="on"
+ioapic="on"
+hpet="on"
+pae="on"
+longmode="on"
+vtxux="off"
+boot1="dvd"
+boot2="disk"
+boot3="none"
+boot4="none"
+VMState="running"
+storagecontrollername0="SATA"
+storagecontrollertype0="IntelAhci"
+storagecontrollerinstance0="0"
+storagecontrollermaxportcount0="30"
+storagecontrollerportcount0="4"
+storagecontrollerbootable0="on"
+"SATA-0-0"="/Users/sven/.boot2docker/boot2docker.iso"
+"SATA-ImageUUID-0-0"="c1d2e3f4-0000-0000-0000-000000000001"
+"SATA-IsEjected"="off"
+"SATA-1-0"="/Users/sven/VirtualBox VMs/boot2docker-vm/boot2docker-vm.vmdk"
+"SATA-ImageUUID-1-0"="c1d2e3f4-0000-0000-0000-000000000002"
+"SATA-2-0"="none"
+natnet1="nat"
+macaddress1="080027C2E4E1"
+cableconnected1="on"
+nic1="nat"
+nictype1="virtio"
+nicspeed1="0"
+Forwarding(0)="docker,tcp,127.0.0.1,2376,,2376"
+Forwarding(1)="ssh,tcp,127.0.0.1,2022,,22"
+hostonlyadapter2="vboxnet0"
+macaddress2="0800270C5B7A"
+cableconnected2="off"
+nic2="hostonly"
+nictype2="virtio"
+nic3="none"
+uartmode1="server,/Users/sven/.boot2docker/boot2docker-vm.sock"
+SharedFolderNameMachineMapping1="Users"
+SharedFolderPathMachineMapping1="/Users"
+SnapshotName="clean"
+SnapshotUUID="d0000000-0000-0000-0000-000000000001"
+SnapshotName-1="configured"
+SnapshotUUID-1="d0000000-0000-0000-0000-000000000002"
+CurrentSnapshotName="configured"
+GuestAdditionsRunLevel=2
+GuestAdditionsVersion="4.3.20 r96996"
+`
+
+func TestParseMachineInfo(t *testing.T) {
+	m, err := parseMachineInfo(testVMInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "boot2docker-vm" || m.State != driver.Running || m.CPUs != 2 || m.Memory != 2048 {
+		t.Errorf("unexpected machine basics: %+v", m)
+	}
+	if m.SSHPort != 2022 || m.DockerPort != 2376 {
+		t.Errorf("ports: got ssh=%d docker=%d", m.SSHPort, m.DockerPort)
+	}
+	if want := F_acpi | F_ioapic | F_hpet | F_pae | F_longmode; m.Flag != want {
+		t.Errorf("flags: got %b, want %b", m.Flag, want)
+	}
+	if !reflect.DeepEqual(m.BootOrder, []string{"dvd", "disk"}) {
+		t.Errorf("boot order: got %v", m.BootOrder)
+	}
+
+	if len(m.NICs) != 2 {
+		t.Fatalf("expected 2 NICs, got %+v", m.NICs)
+	}
+	nat, hostonly := m.NICs[0], m.NICs[1]
+	if nat.Slot != 1 || nat.Network != driver.NICNetNAT || nat.Hardware != driver.VirtIO || !nat.CableConnected || nat.MacAddr != "080027C2E4E1" {
+		t.Errorf("unexpected NAT NIC: %+v", nat)
+	}
+	if r, ok := nat.PFRules["ssh"]; !ok || r.HostPort != 2022 || r.GuestPort != 22 || !r.HostIP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("unexpected ssh rule: %+v", nat.PFRules)
+	}
+	if hostonly.Slot != 2 || hostonly.Network != driver.NICNetHostonly || hostonly.Adapter != "vboxnet0" || hostonly.CableConnected {
+		t.Errorf("unexpected host-only NIC: %+v", hostonly)
+	}
+	if len(hostonly.PFRules) != 0 {
+		t.Errorf("host-only NIC should have no forwarding rules: %+v", hostonly.PFRules)
+	}
+
+	if len(m.StorageCtls) != 1 || m.StorageCtls[0].Name != "SATA" || m.StorageCtls[0].Ports != 4 || !m.StorageCtls[0].Bootable {
+		t.Errorf("unexpected storage controllers: %+v", m.StorageCtls)
+	}
+	if len(m.Storage) != 2 {
+		t.Fatalf("expected 2 attachments, got %+v", m.Storage)
+	}
+	if a := m.Storage[1]; a.Controller != "SATA" || a.Port != 1 || a.Device != 0 || a.UUID != "c1d2e3f4-0000-0000-0000-000000000002" {
+		t.Errorf("unexpected disk attachment: %+v", a)
+	}
+	if m.Iso != "/Users/sven/.boot2docker/boot2docker.iso" {
+		t.Errorf("iso: got %q", m.Iso)
+	}
+
+	if m.SharedFolders["Users"] != "/Users" {
+		t.Errorf("shared folders: got %v", m.SharedFolders)
+	}
+	if len(m.Snapshots) != 2 || m.Snapshots[1].Name != "configured" || m.Snapshots[1].Path != "-1" || m.CurrentSnapshot != "configured" {
+		t.Errorf("snapshots: got %+v (current %q)", m.Snapshots, m.CurrentSnapshot)
+	}
+	if m.GuestAdditionsVersion != "4.3.20" {
+		t.Errorf("guest additions: got %q", m.GuestAdditionsVersion)
+	}
+}
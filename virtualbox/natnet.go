@@ -2,6 +2,7 @@ package virtualbox
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"strconv"
 	"strings"
@@ -17,8 +18,8 @@ type NATNet struct {
 }
 
 // NATNets gets all NAT networks in a  map keyed by NATNet.Name.
-func NATNets() (map[string]NATNet, error) {
-	out, err := vbmOut("list", "natnets")
+func NATNets(ctx context.Context) (map[string]NATNet, error) {
+	out, err := vbmOut(ctx, "list", "natnets")
 	if err != nil {
 		return nil, err
 	}
@@ -1,9 +1,12 @@
 package virtualbox
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestNATNets(t *testing.T) {
-	m, err := NATNets()
+	m, err := NATNets(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,66 @@
+package virtualbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// How long undoing a failed operation may take. It runs on a fresh context,
+// as the one of the operation may be what was cancelled.
+const rollbackTimeout = 2 * time.Minute
+
+// Completed steps of an operation, to undo in reverse order if it fails.
+type rollback struct {
+	steps []rollbackStep
+}
+
+type rollbackStep struct {
+	desc string
+	undo func(ctx context.Context) error
+}
+
+// Record a completed step, described by desc, and how to undo it.
+func (r *rollback) add(desc string, undo func(ctx context.Context) error) {
+	r.steps = append(r.steps, rollbackStep{desc, undo})
+}
+
+// Undo the recorded steps, last first, carrying on when one fails.
+func (r *rollback) run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	var failed []string
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		step := r.steps[i]
+		fmt.Fprintf(os.Stderr, "Rolling back: %s\n", step.desc)
+		if err := step.undo(ctx); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", step.desc, err))
+		}
+	}
+	r.steps = nil
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to roll back %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Undo the recorded steps if *err is set, unless keep is, in which case
+// they are only listed. Deferred by operations with a named error result,
+// which gets the rollback failures appended.
+func (r *rollback) onError(err *error, keep bool) {
+	if *err == nil || len(r.steps) == 0 {
+		return
+	}
+	if keep {
+		fmt.Fprintf(os.Stderr, "Keeping what was done before the failure (--keep-on-failure):\n")
+		for _, step := range r.steps {
+			fmt.Fprintf(os.Stderr, "  %s\n", step.desc)
+		}
+		return
+	}
+	if rerr := r.run(); rerr != nil {
+		*err = fmt.Errorf("%s (%s)", *err, rerr)
+	}
+}
@@ -0,0 +1,49 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRollback(t *testing.T) {
+	var undone []string
+	step := func(name string, err error) func(context.Context) error {
+		return func(ctx context.Context) error {
+			undone = append(undone, name)
+			return err
+		}
+	}
+
+	// Nothing is undone when the operation succeeds.
+	var rb rollback
+	rb.add("vm", step("vm", nil))
+	var err error
+	rb.onError(&err, false)
+	if len(undone) != 0 {
+		t.Errorf("undid %v after a success", undone)
+	}
+
+	// Nor when asked to keep them.
+	err = errors.New("boom")
+	rb.onError(&err, true)
+	if len(undone) != 0 || err.Error() != "boom" {
+		t.Errorf("undid %v with keep, err %v", undone, err)
+	}
+
+	// Otherwise all the steps are undone in reverse, and the failed ones are
+	// reported along the original error.
+	rb.add("net", step("net", errors.New("busy")))
+	rb.add("disk", step("disk", nil))
+	rb.onError(&err, false)
+	if got := strings.Join(undone, ","); got != "disk,net,vm" {
+		t.Errorf("undid %s, want disk,net,vm", got)
+	}
+	if want := "boom (failed to roll back net: busy)"; err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+	if len(rb.steps) != 0 {
+		t.Errorf("%d steps left after the rollback", len(rb.steps))
+	}
+}
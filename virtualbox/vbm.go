@@ -2,9 +2,12 @@ package virtualbox
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -34,24 +37,33 @@ var (
 	ErrVBMNotFound = errors.New("VBoxManage not found")
 )
 
-func vbm(args ...string) error {
-	cmd := exec.Command(cfg.VBM, args...)
+// Run VBoxManage with args. It is killed when ctx is done, and ctx.Err()
+// returned.
+func vbm(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, cfg.VBM, args...)
 	if verbose {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		log.Printf("executing: %v %v", cfg.VBM, strings.Join(args, " "))
 	}
 	if err := cmd.Run(); err != nil {
-		if ee, ok := err.(*exec.Error); ok && ee == exec.ErrNotFound {
-			return ErrVBMNotFound
-		}
-		return err
+		return vbmError(ctx, err)
 	}
 	return nil
 }
 
-func vbmOut(args ...string) (string, error) {
-	cmd := exec.Command(cfg.VBM, args...)
+func vbmError(ctx context.Context, err error) error {
+	if ee, ok := err.(*exec.Error); ok && ee == exec.ErrNotFound {
+		return ErrVBMNotFound
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func vbmOut(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, cfg.VBM, args...)
 	if verbose {
 		cmd.Stderr = os.Stderr
 		log.Printf("executing: %v %v", cfg.VBM, strings.Join(args, " "))
@@ -59,15 +71,13 @@ func vbmOut(args ...string) (string, error) {
 
 	b, err := cmd.Output()
 	if err != nil {
-		if ee, ok := err.(*exec.Error); ok && ee == exec.ErrNotFound {
-			err = ErrVBMNotFound
-		}
+		err = vbmError(ctx, err)
 	}
 	return string(b), err
 }
 
-func vbmOutErr(args ...string) (string, string, error) {
-	cmd := exec.Command(cfg.VBM, args...)
+func vbmOutErr(ctx context.Context, args ...string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, cfg.VBM, args...)
 	if verbose {
 		log.Printf("executing: %v %v", cfg.VBM, strings.Join(args, " "))
 	}
@@ -77,26 +87,26 @@ func vbmOutErr(args ...string) (string, string, error) {
 	cmd.Stderr = &stderr
 	err := cmd.Run()
 	if err != nil {
-		if ee, ok := err.(*exec.Error); ok && ee == exec.ErrNotFound {
-			err = ErrVBMNotFound
-		}
+		err = vbmError(ctx, err)
 	}
 	return stdout.String(), stderr.String(), err
 }
 
 // Get or create the hostonly network interface
-func getHostOnlyNetworkInterface(mc *driver.MachineConfig) (string, error) {
+func getHostOnlyNetworkInterface(ctx context.Context, mc *driver.MachineConfig, rb *rollback) (string, error) {
 	// Check if the interface/dhcp exists.
-	nets, err := HostonlyNets()
+	nets, err := HostonlyNets(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	dhcps, err := DHCPs()
+	dhcps, err := DHCPs(ctx)
 	if err != nil {
 		return "", err
 	}
 
+	var hostonlyNet *HostonlyNet
+	dhcpConfigured := false
 	for _, n := range nets {
 		if dhcp, ok := dhcps[n.NetworkName]; ok {
 			if dhcp.IPv4.IP.Equal(mc.DHCPIP) &&
@@ -104,20 +114,55 @@ func getHostOnlyNetworkInterface(mc *driver.MachineConfig) (string, error) {
 				dhcp.LowerIP.Equal(mc.LowerIP) &&
 				dhcp.UpperIP.Equal(mc.UpperIP) &&
 				dhcp.Enabled == mc.DHCPEnabled {
-				return n.Name, nil
+				hostonlyNet, dhcpConfigured = n, true
+				break
 			}
 		}
 	}
 
-	// No existing host-only interface found. Create a new one.
-	hostonlyNet, err := CreateHostonlyNet()
-	if err != nil {
-		return "", err
+	// Reuse an interface already configured with the host IP but without a
+	// DHCP server, rather than leaking a new one. One whose DHCP server has
+	// other settings is left alone, as other VMs may rely on them.
+	if hostonlyNet == nil {
+		for _, n := range nets {
+			if _, ok := dhcps[n.NetworkName]; ok {
+				continue
+			}
+			if n.IPv4.IP.Equal(mc.HostIP) && n.IPv4.Mask.String() == mc.NetMask.String() {
+				hostonlyNet = n
+				break
+			}
+		}
 	}
-	hostonlyNet.IPv4.IP = mc.HostIP
-	hostonlyNet.IPv4.Mask = mc.NetMask
-	if err := hostonlyNet.Config(); err != nil {
-		return "", err
+
+	if hostonlyNet == nil {
+		// No existing host-only interface found. Create a new one.
+		hostonlyNet, err = CreateHostonlyNet(ctx)
+		if err != nil {
+			return "", err
+		}
+		n := hostonlyNet
+		rb.add(fmt.Sprintf("remove host-only network %s", n.Name), n.Remove)
+		hostonlyNet.IPv4.IP = mc.HostIP
+		hostonlyNet.IPv4.Mask = mc.NetMask
+		if err := hostonlyNet.Config(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	if mc.HostIPv6 != nil {
+		mask := net.CIDRMask(int(mc.IPv6PrefixLen), net.IPv6len*8)
+		if !hostonlyNet.IPv6.IP.Equal(mc.HostIPv6) || hostonlyNet.IPv6.Mask.String() != mask.String() {
+			hostonlyNet.IPv6.IP = mc.HostIPv6
+			hostonlyNet.IPv6.Mask = mask
+			if err := hostonlyNet.Config(ctx); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if dhcpConfigured {
+		return hostonlyNet.Name, nil
 	}
 
 	// Create and add a DHCP server to the host-only network
@@ -127,7 +172,13 @@ func getHostOnlyNetworkInterface(mc *driver.MachineConfig) (string, error) {
 	dhcp.LowerIP = mc.LowerIP
 	dhcp.UpperIP = mc.UpperIP
 	dhcp.Enabled = true
-	if err := AddHostonlyDHCP(hostonlyNet.Name, dhcp); err != nil {
+	netname := hostonlyNetworkPrefix + hostonlyNet.Name
+	if _, ok := dhcps[netname]; !ok {
+		rb.add(fmt.Sprintf("remove DHCP server of %s", hostonlyNet.Name), func(ctx context.Context) error {
+			return RemoveDHCP(ctx, netname)
+		})
+	}
+	if err := AddHostonlyDHCP(ctx, hostonlyNet.Name, dhcp); err != nil {
 		return "", err
 	}
 	return hostonlyNet.Name, nil
@@ -159,7 +210,7 @@ func copyDiskImage(dst, src string) (err error) {
 }
 
 // Make a boot2docker VM disk image with the given size (in MB).
-func makeDiskImage(dest string, size uint, initialBytes []byte) error {
+func makeDiskImage(ctx context.Context, dest string, size uint, initialBytes []byte) error {
 	// Create the dest dir.
 	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
 		return err
@@ -167,5 +218,5 @@ func makeDiskImage(dest string, size uint, initialBytes []byte) error {
 	// Fill in the magic string so boot2docker VM will detect this and format
 	// the disk upon first boot.
 	raw := bytes.NewReader(initialBytes)
-	return MakeDiskImage(dest, size, raw)
+	return MakeDiskImage(ctx, dest, size, raw)
 }
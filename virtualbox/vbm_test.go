@@ -1,6 +1,7 @@
 package virtualbox
 
 import (
+	"context"
 	"testing"
 )
 
@@ -9,7 +10,7 @@ func init() {
 }
 
 func TestVBMOut(t *testing.T) {
-	b, err := vbmOut("list", "vms")
+	b, err := vbmOut(context.Background(), "list", "vms")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,364 @@
+package virtualbox
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+var (
+	reNICKey            = regexp.MustCompile(`^(nic|nictype|macaddress|cableconnected|hostonlyadapter|bridgeadapter|intnet|natnet)(\d+)$`)
+	reBootKey           = regexp.MustCompile(`^boot(\d)$`)
+	reStorageCtlKey     = regexp.MustCompile(`^storagecontroller(name|type|portcount|bootable)(\d+)$`)
+	reStorageAttachKey  = regexp.MustCompile(`^(.+)-(\d+)-(\d+)$`)
+	reStorageImageKey   = regexp.MustCompile(`^(.+)-ImageUUID-(\d+)-(\d+)$`)
+	reSharedFolderKey   = regexp.MustCompile(`^SharedFolder(Name|Path)MachineMapping(\d+)$`)
+	reSnapshotKey       = regexp.MustCompile(`^Snapshot(Name|UUID)((?:-\d+)*)$`)
+	reForwardingKey     = regexp.MustCompile(`^Forwarding\(\d+\)$`)
+	reGuestAdditionsVer = regexp.MustCompile(`^(\d+\.\d+\.\d+)`)
+)
+
+// Flag names as reported by `showvminfo --machinereadable`.
+var flagNames = map[string]Flag{
+	"acpi":             F_acpi,
+	"ioapic":           F_ioapic,
+	"rtcuseutc":        F_rtcuseutc,
+	"cpuhotplug":       F_cpuhotplug,
+	"pae":              F_pae,
+	"longmode":         F_longmode,
+	"hpet":             F_hpet,
+	"hwvirtex":         F_hwvirtex,
+	"triplefaultreset": F_triplefaultreset,
+	"nestedpaging":     F_nestedpaging,
+	"largepages":       F_largepages,
+	"vtxvpid":          F_vtxvpid,
+	"vtxux":            F_vtxux,
+	"accelerate3d":     F_accelerate3d,
+}
+
+// NICInfo describes the configuration of a network adapter slot.
+type NICInfo struct {
+	Slot           int // 1-based, as in `--nic<n>`
+	Network        driver.NICNetwork
+	Hardware       driver.NICHardware
+	Adapter        string // host-only/bridged host interface, or internal/NAT network name
+	MacAddr        string
+	CableConnected bool
+	PFRules        map[string]driver.PFRule // NAT port forwarding rules keyed by name
+}
+
+// StorageCtlInfo describes a storage controller.
+type StorageCtlInfo struct {
+	Name     string
+	Type     string
+	Ports    uint
+	Bootable bool
+}
+
+// StorageAttachment describes a medium attached to a storage controller.
+type StorageAttachment struct {
+	Controller string
+	Port       uint
+	Device     uint
+	Medium     string // path of the attached image, or "emptydrive"
+	UUID       string
+}
+
+// Snapshot describes a VM snapshot. Path is the position in the snapshot
+// tree as reported by VBoxManage (e.g. "" for the root, "-1-1" for the first
+// child of the first child).
+type Snapshot struct {
+	Name string
+	UUID string
+	Path string
+}
+
+// parseMachineInfo parses the output of `showvminfo --machinereadable`.
+func parseMachineInfo(out string) (*Machine, error) {
+	m := &Machine{
+		SharedFolders: map[string]string{},
+	}
+	nics := map[int]*NICInfo{}
+	nic := func(n int) *NICInfo {
+		if _, ok := nics[n]; !ok {
+			nics[n] = &NICInfo{Slot: n, PFRules: map[string]driver.PFRule{}}
+		}
+		return nics[n]
+	}
+	lastNIC := 0
+	ctls := map[int]*StorageCtlInfo{}
+	ctl := func(n int) *StorageCtlInfo {
+		if _, ok := ctls[n]; !ok {
+			ctls[n] = &StorageCtlInfo{}
+		}
+		return ctls[n]
+	}
+	boot := map[int]string{}
+	shareNames := map[int]string{}
+	sharePaths := map[int]string{}
+	snapshots := map[string]*Snapshot{}
+	snapshot := func(path string) *Snapshot {
+		if _, ok := snapshots[path]; !ok {
+			snapshots[path] = &Snapshot{Path: path}
+		}
+		return snapshots[path]
+	}
+	type kv struct{ key, val string }
+	var deferred []kv // storage attachments, resolved once all controllers are known
+
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		res := reVMInfoLine.FindStringSubmatch(s.Text())
+		if res == nil {
+			continue
+		}
+		key := res[1]
+		if key == "" {
+			key = res[2]
+		}
+		val := res[3]
+		if val == "" {
+			val = res[4]
+		}
+
+		switch key {
+		case "name":
+			m.Name = val
+		case "UUID":
+			m.UUID = val
+		case "SATA-0-0":
+			m.Iso = val
+			deferred = append(deferred, kv{key, val})
+		case "VMState":
+			m.State = driver.MachineState(val)
+		case "memory":
+			n, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			m.Memory = uint(n)
+		case "cpus":
+			n, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			m.CPUs = uint(n)
+		case "vram":
+			n, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			m.VRAM = uint(n)
+		case "CfgFile":
+			m.CfgFile = val
+			m.BaseFolder = filepath.Dir(val)
+		case "uartmode1":
+			// uartmode1="server,/home/sven/.boot2docker/boot2docker-vm.sock"
+			vals := strings.Split(val, ",")
+			if len(vals) >= 2 {
+				m.SerialFile = vals[1]
+			}
+		case "GuestAdditionsVersion":
+			// GuestAdditionsVersion="4.3.20 r96996"
+			m.GuestAdditionsVersion = reGuestAdditionsVer.FindString(val)
+		case "CurrentSnapshotName":
+			m.CurrentSnapshot = val
+		default:
+			if f, ok := flagNames[key]; ok {
+				if val == "on" {
+					m.Flag |= f
+				}
+				continue
+			}
+			if r := reNICKey.FindStringSubmatch(key); r != nil {
+				n, _ := strconv.Atoi(r[2])
+				switch r[1] {
+				case "nic":
+					if val == string(driver.NICNetAbsent) {
+						continue
+					}
+					nic(n).Network = driver.NICNetwork(val)
+					lastNIC = n
+				case "nictype":
+					nic(n).Hardware = driver.NICHardware(val)
+				case "macaddress":
+					nic(n).MacAddr = val
+				case "cableconnected":
+					nic(n).CableConnected = (val == "on")
+				case "hostonlyadapter", "bridgeadapter", "intnet", "natnet":
+					nic(n).Adapter = val
+				}
+				continue
+			}
+			if reForwardingKey.MatchString(key) {
+				// "Forwarding(\d*)" are ordered by the name inside the val, not fixed order.
+				// Forwarding(0)="docker,tcp,127.0.0.1,5555,,"
+				// Forwarding(1)="ssh,tcp,127.0.0.1,2222,,22"
+				name, rule, err := parsePFRule(val)
+				if err != nil {
+					return nil, err
+				}
+				switch name {
+				case "docker":
+					m.DockerPort = uint(rule.HostPort)
+				case "ssh":
+					m.SSHPort = uint(rule.HostPort)
+				}
+				if lastNIC > 0 {
+					nic(lastNIC).PFRules[name] = rule
+				}
+				continue
+			}
+			if r := reBootKey.FindStringSubmatch(key); r != nil {
+				n, _ := strconv.Atoi(r[1])
+				boot[n] = val
+				continue
+			}
+			if r := reStorageCtlKey.FindStringSubmatch(key); r != nil {
+				n, _ := strconv.Atoi(r[2])
+				switch r[1] {
+				case "name":
+					ctl(n).Name = val
+				case "type":
+					ctl(n).Type = val
+				case "portcount":
+					p, err := strconv.ParseUint(val, 10, 32)
+					if err != nil {
+						return nil, err
+					}
+					ctl(n).Ports = uint(p)
+				case "bootable":
+					ctl(n).Bootable = (val == "on")
+				}
+				continue
+			}
+			if r := reSharedFolderKey.FindStringSubmatch(key); r != nil {
+				n, _ := strconv.Atoi(r[2])
+				if r[1] == "Name" {
+					shareNames[n] = val
+				} else {
+					sharePaths[n] = val
+				}
+				continue
+			}
+			if r := reSnapshotKey.FindStringSubmatch(key); r != nil {
+				if r[1] == "Name" {
+					snapshot(r[2]).Name = val
+				} else {
+					snapshot(r[2]).UUID = val
+				}
+				continue
+			}
+			if reStorageAttachKey.MatchString(key) || reStorageImageKey.MatchString(key) {
+				deferred = append(deferred, kv{key, val})
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	nicIdx := make([]int, 0, len(nics))
+	for n := range nics {
+		nicIdx = append(nicIdx, n)
+	}
+	sort.Ints(nicIdx)
+	for _, n := range nicIdx {
+		m.NICs = append(m.NICs, *nics[n])
+	}
+
+	ctlNames := map[string]bool{}
+	ctlIdx := make([]int, 0, len(ctls))
+	for n := range ctls {
+		ctlIdx = append(ctlIdx, n)
+	}
+	sort.Ints(ctlIdx)
+	for _, n := range ctlIdx {
+		m.StorageCtls = append(m.StorageCtls, *ctls[n])
+		ctlNames[ctls[n].Name] = true
+	}
+
+	// Storage attachment keys are only recognizable once we know the
+	// controller names, e.g. "SATA-1-0" and "SATA-ImageUUID-1-0".
+	attachments := map[string]*StorageAttachment{}
+	var order []string
+	for _, e := range deferred {
+		if r := reStorageImageKey.FindStringSubmatch(e.key); r != nil && ctlNames[r[1]] {
+			id := r[1] + "-" + r[2] + "-" + r[3]
+			if a, ok := attachments[id]; ok {
+				a.UUID = e.val
+			}
+			continue
+		}
+		r := reStorageAttachKey.FindStringSubmatch(e.key)
+		if r == nil || !ctlNames[r[1]] || e.val == "none" {
+			continue
+		}
+		port, _ := strconv.ParseUint(r[2], 10, 32)
+		dev, _ := strconv.ParseUint(r[3], 10, 32)
+		attachments[e.key] = &StorageAttachment{Controller: r[1], Port: uint(port), Device: uint(dev), Medium: e.val}
+		order = append(order, e.key)
+	}
+	for _, id := range order {
+		m.Storage = append(m.Storage, *attachments[id])
+	}
+
+	for i := 1; i <= 4; i++ {
+		if dev, ok := boot[i]; ok {
+			m.BootOrder = append(m.BootOrder, dev)
+		}
+	}
+	// Trailing "none" slots carry no information.
+	for len(m.BootOrder) > 0 && m.BootOrder[len(m.BootOrder)-1] == "none" {
+		m.BootOrder = m.BootOrder[:len(m.BootOrder)-1]
+	}
+
+	for n, name := range shareNames {
+		m.SharedFolders[name] = sharePaths[n]
+	}
+
+	paths := make([]string, 0, len(snapshots))
+	for p := range snapshots {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		m.Snapshots = append(m.Snapshots, *snapshots[p])
+	}
+
+	return m, nil
+}
+
+// parsePFRule parses a NAT port forwarding rule in the format used by
+// VBoxManage, e.g. "ssh,tcp,127.0.0.1,2022,,22".
+func parsePFRule(val string) (string, driver.PFRule, error) {
+	vals := strings.Split(val, ",")
+	if len(vals) != 6 {
+		return "", driver.PFRule{}, fmt.Errorf("invalid port forwarding rule %q", val)
+	}
+	rule := driver.PFRule{
+		Proto:   driver.PFProto(vals[1]),
+		HostIP:  net.ParseIP(vals[2]),
+		GuestIP: net.ParseIP(vals[4]),
+	}
+	n, err := strconv.ParseUint(vals[3], 10, 16)
+	if err != nil {
+		return "", driver.PFRule{}, err
+	}
+	rule.HostPort = uint16(n)
+	if vals[5] != "" {
+		n, err := strconv.ParseUint(vals[5], 10, 16)
+		if err != nil {
+			return "", driver.PFRule{}, err
+		}
+		rule.GuestPort = uint16(n)
+	}
+	return vals[0], rule, nil
+}
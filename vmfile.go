@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Quote s for the shell of the VM.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Read a file in the VM over SSH. A missing file reads as empty; any other
+// failure is an error, so that callers do not rewrite the file from scratch.
+func readVMFile(m driver.Machine, path string) (string, error) {
+	out, err := getSSHCommand(m, fmt.Sprintf("test -e %s || exit 0; sudo cat %s", path, path)).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", path, err)
+	}
+	return string(out), nil
+}
+
+// Write a file in the VM over SSH, creating its directory if needed.
+func writeVMFile(m driver.Machine, path, content string, mode uint32) error {
+	dir := path[:strings.LastIndex(path, "/")+1]
+	cmd := getSSHCommand(m, fmt.Sprintf("sudo mkdir -p %s && sudo tee %s >/dev/null && sudo chmod %o %s", dir, path, mode, path))
+	cmd.Stdin = strings.NewReader(content)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write %s: %s", path, err)
+	}
+	return nil
+}
+
+// Replace the block between the begin and end marker lines of the file at
+// path in the VM by lines (see setMarkedBlock). The file is created with
+// header when missing. Returns whether the file changed.
+func setVMFileBlock(m driver.Machine, path, header, begin, end string, lines []string, mode uint32) (bool, error) {
+	content, err := readVMFile(m, path)
+	if err != nil {
+		return false, err
+	}
+	updated := setMarkedBlock(content, begin, end, lines)
+	if updated == content {
+		return false, nil
+	}
+	if content == "" {
+		updated = header + updated
+	}
+	return true, writeVMFile(m, path, updated, mode)
+}
+
+// Line printed by scripts run in the VM when CA certificates were added, so
+// that the Docker daemon gets restarted to pick them up.
+const certsChangedMarker = "boot2docker: certs changed"
+
+// Run command in the VM over SSH with stdin, showing its output. Returns
+// whether it printed certsChangedMarker.
+func runVMScript(m driver.Machine, command string, stdin io.Reader) (bool, error) {
+	cmd := getSSHCommand(m, command)
+	cmd.Stdin = stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+
+	changed := false
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if s.Text() == certsChangedMarker {
+			changed = true
+			continue
+		}
+		fmt.Println(s.Text())
+	}
+	return changed, err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Point B2D.SSH at a fake ssh running the remote command locally, with a
+// sudo that just runs its arguments.
+func fakeSSH(t *testing.T, dir string) {
+	scripts := map[string]string{
+		"ssh":  "#!/bin/sh\nfor last; do :; done\nPATH=\"" + dir + ":$PATH\" exec sh -c \"$last\"\n",
+		"sudo": "#!/bin/sh\nexec \"$@\"\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	B2D.SSH = filepath.Join(dir, "ssh")
+}
+
+func TestReadVMFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh is a shell script")
+	}
+	saved := B2D
+	defer func() { B2D = saved }()
+	dir, err := ioutil.TempDir("", "b2d-vmfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fakeSSH(t, dir)
+	B2D.Driver = "dummy"
+	m, err := driver.GetMachine(context.Background(), &B2D)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := filepath.Join(dir, "profile")
+	if content, err := readVMFile(m, profile); err != nil || content != "" {
+		t.Errorf("missing file: got %q (%v), want it empty", content, err)
+	}
+	if err := ioutil.WriteFile(profile, []byte("EXTRA_ARGS=--debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := readVMFile(m, profile); err != nil || content != "EXTRA_ARGS=--debug\n" {
+		t.Errorf("got %q (%v)", content, err)
+	}
+
+	// An unreadable file is an error, not an empty file to rewrite.
+	if err := os.Mkdir(filepath.Join(dir, "adir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readVMFile(m, filepath.Join(dir, "adir")); err == nil || !strings.Contains(err.Error(), "failed to read") {
+		t.Errorf("got %v, want a read error", err)
+	}
+	if _, err := setVMFileBlock(m, filepath.Join(dir, "adir"), "", "# begin", "# end", []string{"x"}, 0644); err == nil {
+		t.Errorf("setVMFileBlock rewrote an unreadable file")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	toml "github.com/BurntSushi/toml"
+	"github.com/boot2docker/boot2docker-cli/driver"
+)
+
+// Per-VM settings managed by boot2docker itself, as opposed to the
+// user-edited profile. They are kept in <boot2docker dir>/profiles/<vm> so
+// they survive a `delete` + `init` cycle.
+type vmProfile struct {
+	// NAT port forwarding rules added with `boot2docker port add`, keyed by
+	// rule name.
+	Ports map[string]driver.PFRule
+
+	// Docker daemon settings set with `boot2docker daemon config`, keyed by
+	// setting name.
+	Daemon map[string]string
+
+	// Host-only network picked by --hostip=auto.
+	HostIP  net.IP
+	NetMask net.IPMask
+	DHCPIP  net.IP
+	LowerIP net.IP
+	UpperIP net.IP
+
+	// --provision directory of `init`, uploaded by the first `up`.
+	Provision string
+}
+
+func vmProfileFilename() string {
+	return filepath.Join(B2D.Dir, "profiles", B2D.VM)
+}
+
+// Read the per-VM profile of B2D.VM. A missing file yields an empty profile.
+func loadVMProfile() (*vmProfile, error) {
+	p := &vmProfile{}
+	if _, err := toml.DecodeFile(vmProfileFilename(), p); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if p.Ports == nil {
+		p.Ports = map[string]driver.PFRule{}
+	}
+	if p.Daemon == nil {
+		p.Daemon = map[string]string{}
+	}
+	return p, nil
+}
+
+// Write the per-VM profile of B2D.VM.
+func (p *vmProfile) save() error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(p); err != nil {
+		return err
+	}
+	filename := vmProfileFilename()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}